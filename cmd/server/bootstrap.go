@@ -1,23 +1,142 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"order-service/internal/config"
 	"order-service/internal/kafka"
+	"order-service/internal/pii"
 	"order-service/internal/repository"
 	"order-service/internal/service"
 )
 
-func setupComponents(cfg *config.Config) (*repository.DB, *service.Service, *kafka.Consumer) {
-	db, err := repository.NewDB(cfg.DatabaseURL)
+type components struct {
+	repo storage
+	// Все подключения к бд (шарды или одна бд) для обслуживания секций
+	dbs []*repository.DB
+
+	svc           *service.Service
+	kafkaConsumer *kafka.Consumer
+
+	// Синхронизация кэшей, nil если KAFKA_CACHE_TOPIC не задан
+	changePublisher *kafka.ChangePublisher
+	cacheSync       *kafka.CacheSync
+	// Ретрансляторы outbox, по одному на бд
+	outboxRelays []*kafka.OutboxRelay
+
+	snapshotInterval time.Duration
+	partitions       repository.PartitionConfig
+	ctx              context.Context
+	cancel           context.CancelFunc
+}
+
+func setupComponents(cfg *config.Config) *components {
+	repo, dbs, err := openStorage(cfg)
 	if err != nil {
 		log.Fatalf("Ошибка подключения к бд: %v", err)
 	}
 
-	cache := repository.NewCache(cfg.CacheCapacity)
-	svc := service.New(db, cache)
-	kafkaConsumer := kafka.New(cfg.KafkaBrokers, cfg.KafkaTopic, cfg.KafkaGroupID, svc)
+	c := &components{
+		repo:             repo,
+		dbs:              dbs,
+		snapshotInterval: cfg.CacheSnapshotInterval,
+		partitions: repository.PartitionConfig{
+			Interval:    cfg.PartitionInterval,
+			MonthsAhead: cfg.PartitionMonthsAhead,
+			Retention:   cfg.OrderRetention,
+			DetachOnly:  cfg.PartitionDetachOnly,
+		},
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	var opts []service.Option
+	if cfg.CacheSnapshotPath != "" {
+		opts = append(opts, service.WithCacheSnapshot(cfg.CacheSnapshotPath))
+	}
+	syncOpts, err := cacheSyncOptions(cfg)
+	if err != nil {
+		log.Fatalf("Ошибка загрузки keyring: %v", err)
+	}
+	if cfg.KafkaCacheTopic != "" {
+		c.changePublisher = kafka.NewChangePublisher(cfg.KafkaBrokers, cfg.KafkaCacheTopic, cfg.InstanceID, syncOpts...)
+		opts = append(opts, service.WithChangeNotifier(c.changePublisher))
+	}
+
+	if cfg.CacheRefreshAhead > 0 {
+		opts = append(opts, service.WithRefreshAhead(cfg.CacheRefreshAhead, cfg.CacheRefreshWorkers))
+	}
+
+	cache := repository.NewCacheWithTTL(cfg.CacheCapacity, cfg.CacheTTL)
+	c.svc = service.New(repo, cache, opts...)
+	c.kafkaConsumer = kafka.New(cfg.KafkaBrokers, cfg.KafkaTopic, cfg.KafkaGroupID, c.svc,
+		kafka.WithBatching(cfg.KafkaBatchSize, cfg.KafkaBatchTimeout))
+
+	if cfg.KafkaAcceptedTopic != "" {
+		for _, db := range dbs {
+			c.outboxRelays = append(c.outboxRelays, kafka.NewOutboxRelay(cfg.KafkaBrokers, cfg.KafkaAcceptedTopic, db,
+				kafka.WithRelayPolling(cfg.OutboxPollInterval, cfg.OutboxBatchSize),
+				kafka.WithRelayRetention(cfg.OutboxRetention)))
+		}
+	}
+
+	if cfg.KafkaCacheTopic != "" {
+		c.cacheSync = kafka.NewCacheSync(cfg.KafkaBrokers, cfg.KafkaCacheTopic, cfg.KafkaGroupID, cfg.InstanceID, c.svc, syncOpts...)
+	}
+
+	return c
+}
 
-	return db, svc, kafkaConsumer
+// cacheSyncOptions шифрует доставку в событиях синхронизации кэшей, если
+// персональные данные зашифрованы в бд
+func cacheSyncOptions(cfg *config.Config) ([]kafka.CacheSyncOption, error) {
+	if cfg.KafkaCacheTopic == "" || cfg.PIIKeyringFile == "" {
+		return nil, nil
+	}
+
+	keyring, err := pii.LoadKeyring(cfg.PIIKeyringFile)
+	if err != nil {
+		return nil, err
+	}
+	return []kafka.CacheSyncOption{kafka.WithCacheEncryption(keyring)}, nil
+}
+
+// start запускает фоновые обработчики
+func (c *components) start() {
+	go c.kafkaConsumer.Start()
+
+	if c.cacheSync != nil {
+		go c.cacheSync.Start()
+	}
+
+	go c.svc.RunCacheSnapshots(c.ctx, c.snapshotInterval)
+	for _, db := range c.dbs {
+		go db.RunPartitionMaintenance(c.ctx, c.partitions)
+	}
+	for _, relay := range c.outboxRelays {
+		go relay.Run(c.ctx)
+	}
+}
+
+func (c *components) close() {
+	c.cancel()
+
+	// Снапшот при остановке, чтобы следующий старт был быстрым
+	if err := c.svc.SaveCacheSnapshot(); err != nil {
+		log.Printf("Ошибка сохранения снапшота кэша: %v", err)
+	}
+
+	if c.cacheSync != nil {
+		c.cacheSync.Close()
+	}
+	if c.changePublisher != nil {
+		c.changePublisher.Close()
+	}
+	for _, relay := range c.outboxRelays {
+		relay.Close()
+	}
+	c.kafkaConsumer.Close()
+	c.svc.Close()
+	c.repo.Close()
 }
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"order-service/internal/archive"
+	"order-service/internal/audit"
+	"order-service/internal/config"
+	"order-service/internal/kafka"
+	"order-service/internal/migrations"
+	"order-service/internal/repository"
+)
+
+// runCommand выполняет подкоманду CLI вместо запуска сервера
+func runCommand(cfg *config.Config, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(cfg, args[1:])
+	case "archive":
+		return runArchive(cfg, args[1:])
+	case "restore":
+		return runRestore(cfg, args[1:])
+	case "shard-move":
+		return runShardMove(cfg, args[1:])
+	case "erase-customer":
+		return runEraseCustomer(cfg, args[1:])
+	case "reencrypt-pii":
+		return runReencryptPII(cfg, args[1:])
+	default:
+		return fmt.Errorf("неизвестная команда %q", args[0])
+	}
+}
+
+// cliContext контекст команды: изменения заказов попадают в журнал от ее имени
+func cliContext(command string) context.Context {
+	return audit.WithSource(context.Background(), audit.Source{
+		Type:   audit.SourceCLI,
+		User:   os.Getenv("USER"),
+		Detail: command,
+	})
+}
+
+// runMigrate: migrate up|down|status|redo
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("использование: migrate up|down|status|redo")
+	}
+
+	// При шардировании миграции применяются к каждому шарду
+	for _, url := range cfg.DatabaseURLs() {
+		if err := migrate(url, args[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrate(url, command string) error {
+	migrator, err := migrations.NewMigrator(url)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	ctx := context.Background()
+	switch command {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		return migrator.Down(ctx)
+	case "redo":
+		return migrator.Redo(ctx)
+	case "status":
+		return migrator.Status(ctx, os.Stdout)
+	default:
+		return fmt.Errorf("неизвестная команда migrate %q", command)
+	}
+}
+
+// autoMigrate накатывает миграции на все бд перед стартом сервера
+func autoMigrate(cfg *config.Config) {
+	for _, url := range cfg.DatabaseURLs() {
+		if err := migrate(url, "up"); err != nil {
+			log.Fatalf("Ошибка применения миграций: %v", err)
+		}
+	}
+}
+
+// runArchive: archive -older-than 8760h [-dir path]
+func runArchive(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("archive", flag.ContinueOnError)
+	olderThan := flags.Duration("older-than", 0, "архивировать заказы старше указанного срока")
+	dir := flags.String("dir", cfg.ArchiveDir, "каталог архива")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *olderThan <= 0 {
+		return fmt.Errorf("использование: archive -older-than 8760h [-dir path]")
+	}
+
+	db, _, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	opts := []archive.Option{archive.WithMaxOrdersPerFile(cfg.ArchiveMaxOrdersPerFile)}
+	if cfg.KafkaCacheTopic != "" {
+		// Работающие инстансы должны забыть удаленные заказы
+		publisher := kafka.NewChangePublisher(cfg.KafkaBrokers, cfg.KafkaCacheTopic, cfg.InstanceID+"-archive")
+		defer publisher.Close()
+		opts = append(opts, archive.WithEvicter(publisher))
+	}
+
+	cutoff := time.Now().Add(-*olderThan)
+	manifest, err := archive.New(db, *dir, opts...).Archive(cliContext("archive"), cutoff)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Архивация завершена: %d заказов старше %s в %d файлах", manifest.Orders, cutoff.Format(time.RFC3339), len(manifest.Files))
+	return nil
+}
+
+// runRestore: restore <файл архива>
+func runRestore(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("использование: restore <файл архива>")
+	}
+
+	db, _, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := archive.New(db, cfg.ArchiveDir).Restore(cliContext("restore "+args[0]), args[0])
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Восстановлено заказов: %d, ошибок: %d", result.Restored, result.Failed)
+	return nil
+}
+
+// runShardMove: shard-move -from 5 -to 9 -source s1 -target s2 [-batch 500]
+func runShardMove(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("shard-move", flag.ContinueOnError)
+	from := flags.Int("from", 0, "начало отрезка shardkey")
+	to := flags.Int("to", -1, "конец отрезка shardkey (включительно)")
+	source := flags.String("source", "", "шард, с которого переносятся заказы")
+	target := flags.String("target", "", "шард, на который переносятся заказы")
+	batch := flags.Int("batch", 500, "заказов в одной транзакции")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *from > *to || *source == "" || *target == "" || *source == *target {
+		return fmt.Errorf("использование: shard-move -from 5 -to 9 -source s1 -target s2 [-batch 500]")
+	}
+
+	// Пока карта не переведена в перенос, инстансы пишут новые заказы отрезка в source
+	shardMap, err := repository.ParseShardMap(cfg.DatabaseShardMap)
+	if err != nil {
+		return err
+	}
+	if !shardMap.Moving(*from, *to, *source, *target) {
+		return fmt.Errorf("в DB_SHARD_MAP отрезок %d-%d должен быть в состоянии переноса: %d-%d=%s>%s",
+			*from, *to, *from, *to, *source, *target)
+	}
+
+	sourceDB, err := openShard(cfg, *source)
+	if err != nil {
+		return err
+	}
+	defer sourceDB.Close()
+
+	targetDB, err := openShard(cfg, *target)
+	if err != nil {
+		return err
+	}
+	defer targetDB.Close()
+
+	ctx := cliContext(fmt.Sprintf("shard-move %d-%d %s -> %s", *from, *to, *source, *target))
+	moved, err := repository.MoveShardRange(ctx, sourceDB, targetDB, *from, *to, *batch)
+	if err != nil {
+		return fmt.Errorf("перенесено %d заказов до ошибки: %w", moved, err)
+	}
+
+	log.Printf("Перенос shardkey %d-%d с %s на %s завершен: %d заказов", *from, *to, *source, *target, moved)
+	return nil
+}
+
+// runEraseCustomer: erase-customer [-dry-run] <customer_id>
+func runEraseCustomer(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("erase-customer", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "только показать затронутые заказы")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	customerID := flags.Arg(0)
+	if flags.NArg() != 1 || customerID == "" {
+		return fmt.Errorf("использование: erase-customer [-dry-run] <customer_id>")
+	}
+
+	db, _, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := cliContext("erase-customer")
+	uids, err := db.EraseCustomer(ctx, customerID, *dryRun)
+	for _, orderUID := range uids {
+		fmt.Println(orderUID)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Кэши работающих инстансов узнают об обезличенных заказах через топик синхронизации
+	if cfg.KafkaCacheTopic != "" && !*dryRun {
+		publisher := kafka.NewChangePublisher(cfg.KafkaBrokers, cfg.KafkaCacheTopic, cfg.InstanceID+"-erase")
+		defer publisher.Close()
+		for _, orderUID := range uids {
+			if err := publisher.NotifyOrderEvicted(ctx, orderUID); err != nil {
+				log.Printf("Ошибка рассылки вытеснения заказа %s: %v", orderUID, err)
+			}
+		}
+	}
+
+	if *dryRun {
+		log.Printf("Будет обезличено заказов: %d (dry-run, изменений нет)", len(uids))
+	} else {
+		log.Printf("Обезличено заказов: %d", len(uids))
+	}
+	return nil
+}
+
+// runReencryptPII: reencrypt-pii [-batch 500]
+func runReencryptPII(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("reencrypt-pii", flag.ContinueOnError)
+	batch := flags.Int("batch", 500, "строк в одной транзакции")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *batch <= 0 || cfg.PIIKeyringFile == "" {
+		return fmt.Errorf("использование: PII_KEYRING_FILE=keyring.json reencrypt-pii [-batch 500]")
+	}
+
+	db, dbs, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Доставки и события outbox перешифровываются на каждом шарде,
+	// из журнала убираются открытые значения, записанные до шифрования
+	ctx := context.Background()
+	for _, shard := range dbs {
+		n, err := shard.ReencryptDeliveries(ctx, *batch)
+		if err != nil {
+			return fmt.Errorf("перешифровано %d доставок до ошибки: %w", n, err)
+		}
+		log.Printf("Перешифровано доставок: %d", n)
+
+		n, err = shard.ReencryptOutbox(ctx, *batch)
+		if err != nil {
+			return fmt.Errorf("перешифровано %d событий outbox до ошибки: %w", n, err)
+		}
+		log.Printf("Перешифровано событий outbox: %d", n)
+
+		n, err = shard.MaskAuditPII(ctx, *batch)
+		if err != nil {
+			return fmt.Errorf("замаскировано %d записей журнала до ошибки: %w", n, err)
+		}
+		log.Printf("Замаскировано записей журнала: %d", n)
+	}
+	return nil
+}
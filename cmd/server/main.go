@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"order-service/internal/config"
 )
@@ -13,17 +14,36 @@ func main() {
 		log.Fatalf("Ошибка загрузки конфигурации: %v", err)
 	}
 
+	// Подкоманды CLI, например: order-service migrate up
+	if len(os.Args) > 1 {
+		if err := runCommand(cfg, os.Args[1:]); err != nil {
+			log.Fatalf("Ошибка выполнения команды: %v", err)
+		}
+		return
+	}
+
+	if cfg.AutoMigrate {
+		autoMigrate(cfg)
+	}
+
 	// Инициализация компонентов
-	db, svc, kafkaConsumer := setupComponents(cfg)
-	defer db.Close()
-	defer kafkaConsumer.Close()
+	app := setupComponents(cfg)
+	defer app.close()
 
-	// Запуск Kafka консюмер в фоне
-	go kafkaConsumer.Start()
+	// Запуск Kafka консюмеров в фоне
+	app.start()
 
 	// Настройка и запуск HTTP сервера
-	router := setupRouter(svc)
-	server := startHTTPServer(cfg.HTTP_ADDR, router)
+	authenticator, err := newAuthenticator(cfg)
+	if err != nil {
+		log.Fatalf("Ошибка загрузки ключей аутентификации: %v", err)
+	}
+	limits, err := newHTTPLimits(cfg)
+	if err != nil {
+		log.Fatalf("Ошибка настройки ограничений запросов: %v", err)
+	}
+	router := setupRouter(app.svc, authenticator, cfg.AuthAllowAnonymous, limits)
+	server := startHTTPServer(cfg, router)
 
 	// Ожидание сигнала завершения
 	waitForShutdown(server)
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"order-service/internal/audit"
+	"order-service/internal/auth"
+	"order-service/internal/codec"
+	"order-service/internal/models"
+	"order-service/internal/openapi"
+	"order-service/internal/repository"
+	"order-service/internal/repository/mocks"
+	"order-service/internal/service"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/klauspost/compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func init() {
+	// Тела MessagePack сверяются со схемой через JSON-представление,
+	// Protobuf и страница документации описаны как строки
+	openapi3filter.RegisterBodyDecoder(codec.MsgPack.ContentType(), msgpackBodyDecoder)
+	openapi3filter.RegisterBodyDecoder(codec.Protobuf.ContentType(), openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("text/html", openapi3filter.FileBodyDecoder)
+}
+
+func msgpackBodyDecoder(body io.Reader, _ http.Header, _ *openapi3.SchemaRef, _ openapi3filter.EncodingFn) (any, error) {
+	var value any
+	if err := msgpack.NewDecoder(body).Decode(&value); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &value)
+	return value, err
+}
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+	doc, err := openapi3.NewLoader().LoadFromData(openapi.Spec)
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(context.Background()))
+	return doc
+}
+
+// validOrder заказ, проходящий валидацию сервиса
+func validOrder(orderUID string) *models.Order {
+	return &models.Order{
+		OrderUID: orderUID, TrackNumber: "WBILMTESTTRACK", Entry: "WBIL",
+		Delivery: models.Delivery{
+			Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction: orderUID, Currency: "USD", Provider: "wbpay", Amount: 1817,
+			PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317,
+		},
+		Items: []models.Item{{
+			ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, Rid: "ab4219087a764ae0btest",
+			Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: 317, NmID: 2389212,
+			Brand: "Vivienne Sabo", Status: 202,
+		}},
+		Locale: "en", CustomerID: "test", DeliveryService: "meest", Shardkey: "9", SmID: 99,
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC), OofShard: "1",
+		Version: 1, UpdatedAt: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+// newContractRouter собирает роутер сервиса поверх мока репозитория
+func newContractRouter(t *testing.T) *mux.Router {
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockOrderRepository(ctrl)
+	repo.EXPECT().GetAllOrders(gomock.Any()).Return(map[string]*models.Order{}, nil)
+	repo.EXPECT().GetOrder(gomock.Any(), "missing").Return(nil, repository.ErrOrderNotFound).AnyTimes()
+	repo.EXPECT().UpdateOrder(gomock.Any(), gomock.Any(), int64(1)).
+		DoAndReturn(func(_ context.Context, order *models.Order, _ int64) error {
+			order.Version = 2
+			order.UpdatedAt = time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC)
+			return nil
+		}).AnyTimes()
+	repo.EXPECT().GetOrderAudit(gomock.Any(), "order1").Return([]audit.Entry{{
+		ID: 1, OrderUID: "order1", Operation: audit.OpUpdate,
+		Source:    audit.Source{Type: audit.SourceHTTP, Client: "127.0.0.1:5000", User: "admin"},
+		Changes:   map[string]audit.Change{"locale": {Before: "ru", After: "en"}, "delivery.zip": {Before: nil, After: "2639809"}},
+		CreatedAt: time.Now(),
+	}}, nil).AnyTimes()
+	repo.EXPECT().HealthCheck(gomock.Any()).Return(nil).AnyTimes()
+	repo.EXPECT().EraseCustomer(gomock.Any(), "test", true).Return([]string{"order1"}, nil).AnyTimes()
+	repo.EXPECT().FindOrderUIDsByContact(gomock.Any(), "test@gmail.com", "").Return(nil, nil).AnyTimes()
+
+	cache := repository.NewCache(10)
+	svc := service.New(repo, cache)
+	cache.Set(validOrder("order1"))
+
+	authenticator := auth.NewAuthenticator(auth.WithAPIKeys([]auth.APIKey{
+		{Name: "admin", SHA256: auth.HashAPIKey("admin-key"), Scopes: []string{auth.ScopeAdmin}},
+		{Name: "reader", SHA256: auth.HashAPIKey("reader-key"), Scopes: []string{auth.ScopeOrdersRead}},
+	}))
+	return setupRouter(svc, authenticator, true, httpLimits{maxBodyBytes: 1 << 20})
+}
+
+type contractCase struct {
+	name    string
+	method  string
+	path    string
+	header  map[string]string
+	body    []byte
+	status  int
+	invalid bool // запрос намеренно не соответствует описанию
+}
+
+func TestOpenAPIContract(t *testing.T) {
+	doc := loadSpec(t)
+	specRouter, err := gorillamux.NewRouter(doc)
+	require.NoError(t, err)
+	router := newContractRouter(t)
+
+	admin := map[string]string{"X-API-Key": "admin-key"}
+	orderJSON, err := json.Marshal(validOrder("order1"))
+	require.NoError(t, err)
+
+	// ETag нужен для условного GET и PUT
+	r := httptest.NewRequest("GET", "/order/order1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	cases := []contractCase{
+		{name: "get order", method: "GET", path: "/order/order1", status: 200},
+		{name: "get order as admin", method: "GET", path: "/order/order1", header: admin, status: 200},
+		{name: "get order msgpack", method: "GET", path: "/order/order1",
+			header: map[string]string{"Accept": "application/msgpack"}, status: 200},
+		{name: "get order protobuf", method: "GET", path: "/order/order1",
+			header: map[string]string{"Accept": "application/x-protobuf"}, status: 200},
+		{name: "get order gzip", method: "GET", path: "/order/order1",
+			header: map[string]string{"Accept-Encoding": "gzip", "X-API-Key": "admin-key"}, status: 200},
+		{name: "get order not modified", method: "GET", path: "/order/order1",
+			header: map[string]string{"If-None-Match": etag}, status: 304},
+		{name: "get missing order", method: "GET", path: "/order/missing", status: 404},
+		{name: "get order not acceptable", method: "GET", path: "/order/order1",
+			header: map[string]string{"Accept": "text/html"}, status: 406},
+		{name: "get order bad key", method: "GET", path: "/order/order1",
+			header: map[string]string{"X-API-Key": "wrong"}, status: 401},
+		{name: "update order", method: "PUT", path: "/order/order1", body: orderJSON, status: 200,
+			header: map[string]string{"X-API-Key": "admin-key", "If-Match": etag, "Content-Type": "application/json"}},
+		{name: "update order anonymous", method: "PUT", path: "/order/order1", body: orderJSON, status: 401,
+			header: map[string]string{"If-Match": etag, "Content-Type": "application/json"}},
+		{name: "update order without scope", method: "PUT", path: "/order/order1", body: orderJSON, status: 403,
+			header: map[string]string{"X-API-Key": "reader-key", "If-Match": etag, "Content-Type": "application/json"}},
+		{name: "update order without if-match", method: "PUT", path: "/order/order1", body: orderJSON, status: 428,
+			header: map[string]string{"X-API-Key": "admin-key", "Content-Type": "application/json"}, invalid: true},
+		{name: "update order unsupported type", method: "PUT", path: "/order/order1", body: orderJSON, status: 415,
+			header: map[string]string{"X-API-Key": "admin-key", "If-Match": etag, "Content-Type": "text/plain"}, invalid: true},
+		{name: "order audit", method: "GET", path: "/order/order1/audit", header: admin, status: 200},
+		{name: "order audit anonymous", method: "GET", path: "/order/order1/audit", status: 401},
+		{name: "health", method: "GET", path: "/health", status: 200},
+		{name: "openapi", method: "GET", path: "/openapi.json", status: 200},
+		{name: "docs", method: "GET", path: "/docs", status: 200},
+		{name: "cache stats", method: "GET", path: "/admin/cache/stats", header: admin, status: 200},
+		{name: "cache keys", method: "GET", path: "/admin/cache/keys?limit=5", header: admin, status: 200},
+		{name: "rewarm progress", method: "GET", path: "/admin/cache/rewarm", header: admin, status: 200},
+		{name: "erase customer dry run", method: "POST", path: "/admin/customers/test/erase?dry_run=true", header: admin, status: 200},
+		{name: "find orders", method: "GET", path: "/admin/orders?email=test@gmail.com", header: admin, status: 200},
+		{name: "find orders without contact", method: "GET", path: "/admin/orders", header: admin, status: 400},
+		{name: "evict order", method: "DELETE", path: "/admin/cache/orders/order1", header: admin, status: 204},
+		{name: "evict all", method: "DELETE", path: "/admin/cache/orders", header: admin, status: 204},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			newRequest := func() *http.Request {
+				r := httptest.NewRequest(tc.method, tc.path, bytes.NewReader(tc.body))
+				for k, v := range tc.header {
+					r.Header.Set(k, v)
+				}
+				return r
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, newRequest())
+			require.Equal(t, tc.status, w.Code, w.Body.String())
+
+			route, pathParams, err := specRouter.FindRoute(newRequest())
+			require.NoError(t, err, "операция не описана")
+
+			input := &openapi3filter.RequestValidationInput{
+				Request:    newRequest(),
+				PathParams: pathParams,
+				Route:      route,
+				Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+			}
+			if !tc.invalid {
+				require.NoError(t, openapi3filter.ValidateRequest(context.Background(), input))
+			}
+
+			validateResponse(t, input, route, w)
+		})
+	}
+}
+
+// validateResponse сверяет статус, заголовки и тело ответа с описанием.
+// Сжатое тело распаковывается: схема описывает содержимое.
+func validateResponse(t *testing.T, input *openapi3filter.RequestValidationInput, route *routers.Route, w *httptest.ResponseRecorder) {
+	t.Helper()
+
+	body := w.Body.Bytes()
+	if w.Header().Get("Content-Encoding") == codec.Gzip {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		body, err = io.ReadAll(zr)
+		require.NoError(t, err)
+	}
+
+	if w.Code == http.StatusNotModified {
+		// 304 openapi3filter не проверяет
+		response := route.Operation.Responses.Status(w.Code)
+		require.NotNil(t, response, "статус %d не описан", w.Code)
+		assert.Empty(t, body)
+		return
+	}
+
+	err := openapi3filter.ValidateResponse(context.Background(), (&openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 w.Code,
+		Header:                 w.Header(),
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true, MultiError: true},
+	}).SetBodyBytes(body))
+	assert.NoError(t, err)
+}
+
+// TestOpenAPIRoutes каждый маршрут роутера описан в спецификации и наоборот
+func TestOpenAPIRoutes(t *testing.T) {
+	doc := loadSpec(t)
+
+	var described []string
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			described = append(described, method+" "+path)
+		}
+	}
+
+	var routed []string
+	router := setupRouter(nil, auth.NewAuthenticator(), true, httpLimits{})
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil || path == "/" {
+			// Префиксы подроутеров, статика и веб-интерфейс в API не входят
+			return nil
+		}
+		for _, method := range methods {
+			routed = append(routed, method+" "+path)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	sort.Strings(described)
+	sort.Strings(routed)
+	assert.Equal(t, routed, described)
+}
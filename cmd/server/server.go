@@ -2,21 +2,71 @@ package main
 
 import (
 	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"os"
 
+	"order-service/internal/auth"
+	"order-service/internal/config"
 	"order-service/internal/handler"
+	"order-service/internal/ratelimit"
 	"order-service/internal/service"
 
 	"github.com/gorilla/mux"
 )
 
-func setupRouter(svc *service.Service) *mux.Router {
+// httpLimits ограничения частоты и размера запросов
+type httpLimits struct {
+	// nil - без ограничения частоты
+	limiter *ratelimit.Limiter
+	// Неудачные попытки аутентификации по адресу; nil - без ограничения
+	authFailures *ratelimit.Limiter
+	proxies      ratelimit.TrustedProxies
+	maxBodyBytes int64
+}
+
+func setupRouter(svc *service.Service, authenticator *auth.Authenticator, allowAnonymous bool, limits httpLimits) *mux.Router {
 	h := handler.New(svc)
 	router := mux.NewRouter()
+	// Подбор ключей ограничивается по адресу еще до их проверки
+	if limits.authFailures != nil {
+		router.Use(handler.LimitAuthFailures(limits.authFailures, limits.proxies))
+	}
+	router.Use(handler.Authenticate(authenticator))
+	if limits.limiter != nil {
+		router.Use(handler.RateLimit(limits.limiter, limits.proxies, "/health"))
+	}
+	router.Use(handler.MaxBodySize(limits.maxBodyBytes))
+
+	read := handler.RequireScope(auth.ScopeOrdersRead)
+	write := handler.RequireScope(auth.ScopeOrdersWrite)
+	adminOnly := handler.RequireScope(auth.ScopeAdmin)
 
-	// API routes
-	router.HandleFunc("/order/{id}", h.GetOrder).Methods("GET")
+	// API routes. Анонимное чтение заказа (с маскированием) можно запретить
+	getOrder := http.Handler(http.HandlerFunc(h.GetOrder))
+	if !allowAnonymous {
+		getOrder = read(getOrder)
+	}
+	router.Handle("/order/{id}", getOrder).Methods("GET")
+	router.Handle("/order/{id}", write(http.HandlerFunc(h.UpdateOrder))).Methods("PUT")
+	// Журнал хранит прежние значения персональных данных
+	router.Handle("/order/{id}/audit", adminOnly(http.HandlerFunc(h.OrderAudit))).Methods("GET")
 	router.HandleFunc("/health", h.HealthCheck).Methods("GET")
+	router.HandleFunc("/openapi.json", h.OpenAPISpec).Methods("GET")
+	router.HandleFunc("/docs", h.APIDocs).Methods("GET")
+
+	// Admin API
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(adminOnly)
+	admin.HandleFunc("/cache/stats", h.CacheStats).Methods("GET")
+	admin.HandleFunc("/cache/keys", h.CacheKeys).Methods("GET")
+	admin.HandleFunc("/cache/orders/{id}", h.EvictOrder).Methods("DELETE")
+	admin.HandleFunc("/cache/orders", h.EvictAll).Methods("DELETE")
+	admin.HandleFunc("/cache/rewarm", h.StartRewarm).Methods("POST")
+	admin.HandleFunc("/cache/rewarm", h.RewarmProgress).Methods("GET")
+	admin.HandleFunc("/customers/{id}/erase", h.EraseCustomer).Methods("POST")
+	admin.HandleFunc("/orders", h.FindOrders).Methods("GET")
 
 	// Web interface
 	router.HandleFunc("/", h.ServeWebInterface).Methods("GET")
@@ -28,10 +78,71 @@ func setupRouter(svc *service.Service) *mux.Router {
 	return router
 }
 
-func startHTTPServer(addr string, router *mux.Router) *http.Server {
+// newAuthenticator загружает ключи API и JWKS из файлов конфигурации
+func newAuthenticator(cfg *config.Config) (*auth.Authenticator, error) {
+	var opts []auth.Option
+	if cfg.APIKeysFile != "" {
+		keys, err := auth.LoadAPIKeys(cfg.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, auth.WithAPIKeys(keys))
+	}
+	if cfg.JWKSFile != "" {
+		jwks, err := auth.LoadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, auth.WithJWKS(jwks, cfg.JWTIssuer, cfg.JWTAudience))
+	}
+
+	authenticator := auth.NewAuthenticator(opts...)
+	switch {
+	case authenticator.Enabled():
+	case cfg.AuthAllowAnonymous:
+		log.Println("API_KEYS_FILE и JWKS_FILE не заданы: доступно только анонимное чтение заказов")
+	default:
+		log.Println("API_KEYS_FILE и JWKS_FILE не заданы, AUTH_ALLOW_ANONYMOUS=false: API заказов недоступен")
+	}
+	return authenticator, nil
+}
+
+// newHTTPLimits собирает ограничения запросов из конфигурации
+func newHTTPLimits(cfg *config.Config) (httpLimits, error) {
+	proxies, err := ratelimit.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return httpLimits{}, err
+	}
+
+	limits := httpLimits{proxies: proxies, maxBodyBytes: cfg.HTTPMaxBodyBytes}
+	if cfg.RateLimitRPS > 0 {
+		limits.limiter = ratelimit.New(cfg.RateLimitRPS, cfg.RateLimitBurst)
+	} else {
+		log.Println("RATE_LIMIT_RPS=0: частота запросов не ограничивается")
+	}
+	if cfg.AuthFailuresPerMinute > 0 {
+		limits.authFailures = ratelimit.New(cfg.AuthFailuresPerMinute/60, int(math.Ceil(cfg.AuthFailuresPerMinute)))
+	}
+	return limits, nil
+}
+
+// withMiddleware оборачивает весь роутер, чтобы в журнал запросов
+// попадали и ответы 404/405, которые mux отдает без своих middleware
+func withMiddleware(router *mux.Router) http.Handler {
+	accessLog := handler.AccessLog(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+	return handler.RequestID(accessLog(handler.Recover(router)))
+}
+
+func startHTTPServer(cfg *config.Config, router *mux.Router) *http.Server {
+	addr := cfg.HTTP_ADDR
 	server := &http.Server{
-		Addr:    addr,
-		Handler: router,
+		Addr:              addr,
+		Handler:           withMiddleware(router),
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+		MaxHeaderBytes:    cfg.HTTPMaxHeaderBytes,
 	}
 
 	go func() {
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"order-service/internal/audit"
+	"order-service/internal/auth"
+	"order-service/internal/models"
+	"order-service/internal/repository"
+	"order-service/internal/repository/mocks"
+	"order-service/internal/service"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouterAuth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockOrderRepository(ctrl)
+	repo.EXPECT().GetAllOrders(gomock.Any()).Return(map[string]*models.Order{}, nil)
+	repo.EXPECT().HealthCheck(gomock.Any()).Return(nil).AnyTimes()
+
+	cache := repository.NewCache(10)
+	svc := service.New(repo, cache)
+	cache.Set(validOrder("order1"))
+	authenticator := auth.NewAuthenticator(auth.WithAPIKeys([]auth.APIKey{
+		{Name: "reader", SHA256: auth.HashAPIKey("reader-key"), Scopes: []string{auth.ScopeOrdersRead}},
+		{Name: "writer", SHA256: auth.HashAPIKey("writer-key"), Scopes: []string{auth.ScopeOrdersWrite}},
+		{Name: "ops", SHA256: auth.HashAPIKey("admin-key"), Scopes: []string{auth.ScopeAdmin}},
+	}))
+	// Анонимное чтение выключено, как по умолчанию
+	router := setupRouter(svc, authenticator, false, httpLimits{maxBodyBytes: 1 << 20})
+
+	orderJSON, err := json.Marshal(validOrder("order1"))
+	require.NoError(t, err)
+	request := func(method, path, key string) int {
+		r := httptest.NewRequest(method, path, bytes.NewReader(orderJSON))
+		r.RemoteAddr = "203.0.113.1:5000"
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("If-Match", `"1"`)
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	t.Run("scopes per route", func(t *testing.T) {
+		cases := []struct {
+			method, path, key string
+			status            int
+		}{
+			{"GET", "/health", "", http.StatusOK},
+			{"GET", "/order/order1", "", http.StatusUnauthorized},
+			{"GET", "/order/order1", "writer-key", http.StatusForbidden},
+			{"GET", "/order/order1", "reader-key", http.StatusOK},
+			{"GET", "/order/order1", "admin-key", http.StatusOK},
+			{"PUT", "/order/order1", "", http.StatusUnauthorized},
+			{"PUT", "/order/order1", "reader-key", http.StatusForbidden},
+			{"GET", "/order/order1/audit", "writer-key", http.StatusForbidden},
+			{"GET", "/admin/cache/stats", "", http.StatusUnauthorized},
+			{"GET", "/admin/cache/stats", "reader-key", http.StatusForbidden},
+			{"GET", "/admin/cache/stats", "admin-key", http.StatusOK},
+			{"DELETE", "/admin/cache/orders", "writer-key", http.StatusForbidden},
+			{"POST", "/admin/customers/test/erase", "reader-key", http.StatusForbidden},
+		}
+		for _, tc := range cases {
+			assert.Equal(t, tc.status, request(tc.method, tc.path, tc.key), "%s %s key=%q", tc.method, tc.path, tc.key)
+		}
+	})
+
+	t.Run("update is attributed to the principal", func(t *testing.T) {
+		for key, want := range map[string]audit.Source{
+			"writer-key": {Type: audit.SourceHTTP, Client: "203.0.113.1:5000", User: "writer"},
+			"admin-key":  {Type: audit.SourceAdmin, Client: "203.0.113.1:5000", User: "ops"},
+		} {
+			repo.EXPECT().UpdateOrder(gomock.Any(), gomock.Any(), int64(1)).
+				DoAndReturn(func(ctx context.Context, order *models.Order, _ int64) error {
+					assert.Equal(t, want, audit.SourceFor(ctx, order.OrderUID))
+					order.Version = 2
+					return nil
+				})
+			assert.Equal(t, http.StatusOK, request("PUT", "/order/order1", key))
+		}
+	})
+}
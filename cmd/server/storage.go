@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"order-service/internal/archive"
+	"order-service/internal/config"
+	"order-service/internal/pii"
+	"order-service/internal/repository"
+)
+
+// storage общий интерфейс одиночной и шардированной бд
+type storage interface {
+	repository.OrderRepository
+	archive.Store
+}
+
+// dbOptions настройки пула, сроков запросов и шифрования, общие для всех бд
+func dbOptions(cfg *config.Config) ([]repository.Option, error) {
+	opts := []repository.Option{
+		repository.WithPoolConfig(repository.PoolConfig{
+			MaxConns:          int32(cfg.DatabaseMaxConns),
+			MinConns:          int32(cfg.DatabaseMinConns),
+			MaxConnLifetime:   cfg.DatabaseMaxConnLifetime,
+			MaxConnIdleTime:   cfg.DatabaseMaxConnIdleTime,
+			HealthCheckPeriod: cfg.DatabaseHealthCheckPeriod,
+			StatementTimeout:  cfg.DatabaseStatementTimeout,
+			ApplicationName:   cfg.DatabaseApplicationName,
+		}),
+		repository.WithQueryTimeouts(cfg.DatabaseQueryTimeout, cfg.DatabaseBulkQueryTimeout),
+	}
+
+	if cfg.PIIKeyringFile != "" {
+		keyring, err := pii.LoadKeyring(cfg.PIIKeyringFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, repository.WithFieldEncryption(keyring))
+	}
+
+	return opts, nil
+}
+
+// openStorage подключается к единственной бд (с репликами, если заданы)
+// или к шардам из DB_SHARDS. Возвращает также подключения ко всем бд
+// для обслуживания секций.
+func openStorage(cfg *config.Config) (storage, []*repository.DB, error) {
+	if len(cfg.DatabaseShards) == 0 {
+		opts, err := dbOptions(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts,
+			repository.WithReplicas(cfg.DatabaseReplicaURLs...),
+			repository.WithReplicaCheckInterval(cfg.DatabaseReplicaCheckInterval),
+			repository.WithReadYourWrites(cfg.DatabaseReadYourWrites),
+		)
+		db, err := repository.NewDB(cfg.DatabaseURL, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, []*repository.DB{db}, nil
+	}
+
+	if len(cfg.DatabaseReplicaURLs) > 0 {
+		log.Printf("DB_REPLICA_URLS не используется при заданных DB_SHARDS")
+	}
+
+	shardMap, err := repository.ParseShardMap(cfg.DatabaseShardMap)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	shards := make(map[string]*repository.DB, len(cfg.DatabaseShards))
+	closeShards := func() {
+		for _, db := range shards {
+			db.Close()
+		}
+	}
+	for name := range cfg.DatabaseShards {
+		db, err := openShard(cfg, name)
+		if err != nil {
+			closeShards()
+			return nil, nil, err
+		}
+		shards[name] = db
+	}
+
+	sharded, err := repository.NewShardedDB(shards, shardMap)
+	if err != nil {
+		closeShards()
+		return nil, nil, err
+	}
+
+	log.Printf("Подключено шардов: %d", len(shards))
+	return sharded, sharded.Shards(), nil
+}
+
+// openShard подключается к шарду по имени из DB_SHARDS
+func openShard(cfg *config.Config, name string) (*repository.DB, error) {
+	dsn, ok := cfg.DatabaseShards[name]
+	if !ok {
+		return nil, fmt.Errorf("шард %q не задан в DB_SHARDS", name)
+	}
+
+	opts, err := dbOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := repository.NewDB(dsn, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("шард %s: %w", name, err)
+	}
+	return db, nil
+}
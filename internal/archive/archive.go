@@ -0,0 +1,236 @@
+// Package archive выгружает старые заказы из бд в сжатые файлы NDJSON
+// и загружает их обратно.
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"order-service/internal/models"
+)
+
+var ErrArchiveCorrupted = errors.New("файл архива поврежден")
+
+const (
+	defaultMaxOrdersPerFile = 10000
+	// Сколько заказов удалять одной транзакцией
+	deleteChunkSize = 1000
+	runIDLayout     = "20060102T150405Z"
+)
+
+// Store часть репозитория, нужная архивации
+type Store interface {
+	StreamOrdersBefore(ctx context.Context, cutoff time.Time, fn func(order *models.Order) error) error
+	DeleteOrderVersions(ctx context.Context, versions map[string]int64) ([]string, error)
+	RestoreOrder(ctx context.Context, order *models.Order) error
+}
+
+// Evicter сообщает работающим инстансам, что заказ нужно убрать из кэша
+type Evicter interface {
+	NotifyOrderEvicted(ctx context.Context, orderUID string) error
+}
+
+type Archiver struct {
+	store            Store
+	dir              string
+	maxOrdersPerFile int
+	evicter          Evicter
+}
+
+type Option func(a *Archiver)
+
+// WithMaxOrdersPerFile задает, после скольких заказов начинается новый файл
+func WithMaxOrdersPerFile(n int) Option {
+	return func(a *Archiver) {
+		if n > 0 {
+			a.maxOrdersPerFile = n
+		}
+	}
+}
+
+// WithEvicter включает рассылку вытеснения удаленных заказов из кэшей
+func WithEvicter(evicter Evicter) Option {
+	return func(a *Archiver) {
+		a.evicter = evicter
+	}
+}
+
+func New(store Store, dir string, opts ...Option) *Archiver {
+	a := &Archiver{
+		store:            store,
+		dir:              dir,
+		maxOrdersPerFile: defaultMaxOrdersPerFile,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Archive выгружает заказы, созданные раньше cutoff, в файлы
+// orders-<run>-NNNN.ndjson.zst и манифест manifest-<run>.json.
+// Заказы удаляются из бд только после того, как файл перечитан и сверен.
+func (a *Archiver) Archive(ctx context.Context, cutoff time.Time) (*Manifest, error) {
+	if err := os.MkdirAll(a.dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	runID := now.Format(runIDLayout)
+	manifest := &Manifest{CreatedAt: now, Cutoff: cutoff.UTC()}
+	var written []*fileWriter
+
+	var current *fileWriter
+	closeCurrent := func() error {
+		info, err := current.close()
+		if err != nil {
+			return err
+		}
+		info.Name = filepath.Base(current.path)
+		manifest.Files = append(manifest.Files, info)
+		manifest.Orders += info.Orders
+		written = append(written, current)
+		current = nil
+		return nil
+	}
+
+	err := a.store.StreamOrdersBefore(ctx, cutoff, func(order *models.Order) error {
+		if current != nil && len(current.uids) >= a.maxOrdersPerFile {
+			if err := closeCurrent(); err != nil {
+				return err
+			}
+		}
+		if current == nil {
+			name := fmt.Sprintf("orders-%s-%04d.ndjson.zst", runID, len(manifest.Files)+1)
+			file, err := createFile(filepath.Join(a.dir, name))
+			if err != nil {
+				return err
+			}
+			current = file
+		}
+		return current.write(order)
+	})
+	if err == nil && current != nil {
+		err = closeCurrent()
+	}
+	if err != nil {
+		if current != nil {
+			current.close()
+		}
+		return nil, fmt.Errorf("выгрузка заказов: %w", err)
+	}
+
+	if manifest.Orders == 0 {
+		return manifest, nil
+	}
+
+	manifestPath := filepath.Join(a.dir, "manifest-"+runID+".json")
+	if err := writeManifest(manifestPath, manifest); err != nil {
+		return nil, err
+	}
+
+	for i := range manifest.Files {
+		info := &manifest.Files[i]
+		if err := a.verify(filepath.Join(a.dir, info.Name), info, written[i].uids); err != nil {
+			return manifest, err
+		}
+		skipped, err := a.delete(ctx, written[i])
+		if err != nil {
+			return manifest, fmt.Errorf("удаление заказов из %s: %w", info.Name, err)
+		}
+
+		info.Deleted = true
+		info.Skipped = skipped
+		if err := writeManifest(manifestPath, manifest); err != nil {
+			return manifest, err
+		}
+		log.Printf("Архив %s: %d заказов записано, %d изменены после выгрузки и остались в бд",
+			info.Name, info.Orders, len(skipped))
+	}
+
+	return manifest, nil
+}
+
+// verify перечитывает файл и сверяет его с манифестом и списком записанных заказов
+func (a *Archiver) verify(path string, info *FileInfo, uids []string) error {
+	i := 0
+	return readFile(path, info, func(order *models.Order) error {
+		if i >= len(uids) || order.OrderUID != uids[i] {
+			return fmt.Errorf("%w: %s, строка %d: неожиданный заказ %s", ErrArchiveCorrupted, path, i+1, order.OrderUID)
+		}
+		i++
+		return nil
+	})
+}
+
+// delete удаляет из бд заказы файла, не измененные с момента выгрузки.
+// Возвращает order_uid заказов, оставшихся в бд.
+func (a *Archiver) delete(ctx context.Context, file *fileWriter) ([]string, error) {
+	deleted := make(map[string]bool, len(file.uids))
+	for start := 0; start < len(file.uids); start += deleteChunkSize {
+		chunk := file.uids[start:min(start+deleteChunkSize, len(file.uids))]
+		versions := make(map[string]int64, len(chunk))
+		for _, orderUID := range chunk {
+			versions[orderUID] = file.versions[orderUID]
+		}
+
+		uids, err := a.store.DeleteOrderVersions(ctx, versions)
+		if err != nil {
+			return nil, err
+		}
+		for _, orderUID := range uids {
+			deleted[orderUID] = true
+		}
+	}
+
+	var skipped []string
+	for _, orderUID := range file.uids {
+		if !deleted[orderUID] {
+			skipped = append(skipped, orderUID)
+			continue
+		}
+		if a.evicter == nil {
+			continue
+		}
+		if err := a.evicter.NotifyOrderEvicted(ctx, orderUID); err != nil {
+			log.Printf("Ошибка рассылки вытеснения заказа %s: %v", orderUID, err)
+		}
+	}
+
+	return skipped, nil
+}
+
+// RestoreResult итог загрузки файла архива
+type RestoreResult struct {
+	Restored int
+	Failed   int
+}
+
+// Restore загружает заказы из файла архива обратно в бд с их прежними версиями.
+// Если файл описан в манифесте своего каталога, сначала сверяется контрольная сумма.
+// Ошибки отдельных заказов (например, заказ уже есть в бд) логируются и не прерывают загрузку.
+func (a *Archiver) Restore(ctx context.Context, path string) (RestoreResult, error) {
+	info, err := findFileInfo(path)
+	if err != nil {
+		log.Printf("Архив %s: контрольная сумма не проверяется: %v", path, err)
+		info = nil
+	}
+
+	var result RestoreResult
+	err = readFile(path, info, func(order *models.Order) error {
+		if err := a.store.RestoreOrder(ctx, order); err != nil {
+			log.Printf("Архив %s: ошибка загрузки заказа %s: %v", path, order.OrderUID, err)
+			result.Failed++
+			return nil
+		}
+		result.Restored++
+		return nil
+	})
+
+	return result, err
+}
@@ -0,0 +1,157 @@
+package archive_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"order-service/internal/archive"
+	"order-service/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore хранилище заказов в памяти
+type memoryStore struct {
+	orders  []*models.Order
+	deleted []string
+	saved   []*models.Order
+	// changed заказы, измененные в бд после выгрузки
+	changed map[string]bool
+}
+
+func (m *memoryStore) StreamOrdersBefore(ctx context.Context, cutoff time.Time, fn func(order *models.Order) error) error {
+	for _, order := range m.orders {
+		if order.DateCreated.Before(cutoff) {
+			if err := fn(order); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) DeleteOrderVersions(ctx context.Context, versions map[string]int64) ([]string, error) {
+	var deleted []string
+	for _, order := range m.orders {
+		version, ok := versions[order.OrderUID]
+		if ok && version == order.Version && !m.changed[order.OrderUID] {
+			deleted = append(deleted, order.OrderUID)
+		}
+	}
+	m.deleted = append(m.deleted, deleted...)
+	return deleted, nil
+}
+
+func (m *memoryStore) RestoreOrder(ctx context.Context, order *models.Order) error {
+	m.saved = append(m.saved, order)
+	return nil
+}
+
+func testOrders(n int, created time.Time) []*models.Order {
+	orders := make([]*models.Order, n)
+	for i := range orders {
+		orders[i] = &models.Order{
+			OrderUID:    fmt.Sprintf("order%d", i),
+			Version:     int64(i + 1),
+			DateCreated: created.Add(time.Duration(i) * time.Minute),
+			Delivery:    models.Delivery{Name: "Test Testov"},
+			Items:       []models.Item{{ChrtID: i, Name: "Mascaras"}},
+		}
+	}
+	return orders
+}
+
+func TestArchive(t *testing.T) {
+	ctx := context.Background()
+	cutoff := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("rotates files and deletes archived orders", func(t *testing.T) {
+		old := testOrders(5, cutoff.AddDate(0, -1, 0))
+		recent := &models.Order{OrderUID: "recent", DateCreated: cutoff.Add(time.Hour)}
+		store := &memoryStore{orders: append(old, recent)}
+		dir := t.TempDir()
+
+		manifest, err := archive.New(store, dir, archive.WithMaxOrdersPerFile(2)).Archive(ctx, cutoff)
+		require.NoError(t, err)
+
+		assert.Equal(t, 5, manifest.Orders)
+		require.Len(t, manifest.Files, 3)
+		assert.Equal(t, []int{2, 2, 1}, []int{manifest.Files[0].Orders, manifest.Files[1].Orders, manifest.Files[2].Orders})
+		for _, file := range manifest.Files {
+			assert.True(t, file.Deleted)
+		}
+		assert.Equal(t, []string{"order0", "order1", "order2", "order3", "order4"}, store.deleted)
+
+		manifests, err := filepath.Glob(filepath.Join(dir, "manifest-*.json"))
+		require.NoError(t, err)
+		assert.Len(t, manifests, 1)
+	})
+
+	t.Run("keeps orders changed after export", func(t *testing.T) {
+		store := &memoryStore{orders: testOrders(3, cutoff.AddDate(0, -1, 0)), changed: map[string]bool{"order1": true}}
+		dir := t.TempDir()
+
+		manifest, err := archive.New(store, dir).Archive(ctx, cutoff)
+		require.NoError(t, err)
+
+		require.Len(t, manifest.Files, 1)
+		assert.Equal(t, 3, manifest.Files[0].Orders)
+		assert.True(t, manifest.Files[0].Deleted)
+		assert.Equal(t, []string{"order1"}, manifest.Files[0].Skipped)
+		assert.Equal(t, []string{"order0", "order2"}, store.deleted)
+	})
+
+	t.Run("nothing to archive", func(t *testing.T) {
+		store := &memoryStore{orders: testOrders(2, cutoff.Add(time.Hour))}
+		dir := t.TempDir()
+
+		manifest, err := archive.New(store, dir).Archive(ctx, cutoff)
+		require.NoError(t, err)
+		assert.Zero(t, manifest.Orders)
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("restore round trip", func(t *testing.T) {
+		old := testOrders(3, cutoff.AddDate(0, -1, 0))
+		store := &memoryStore{orders: old}
+		dir := t.TempDir()
+		archiver := archive.New(store, dir)
+
+		manifest, err := archiver.Archive(ctx, cutoff)
+		require.NoError(t, err)
+		require.Len(t, manifest.Files, 1)
+
+		result, err := archiver.Restore(ctx, filepath.Join(dir, manifest.Files[0].Name))
+		require.NoError(t, err)
+		assert.Equal(t, archive.RestoreResult{Restored: 3}, result)
+		assert.Equal(t, old, store.saved)
+	})
+
+	t.Run("restore rejects corrupted file", func(t *testing.T) {
+		store := &memoryStore{orders: testOrders(3, cutoff.AddDate(0, -1, 0))}
+		dir := t.TempDir()
+		archiver := archive.New(store, dir)
+
+		manifest, err := archiver.Archive(ctx, cutoff)
+		require.NoError(t, err)
+
+		path := filepath.Join(dir, manifest.Files[0].Name)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		data[len(data)/2] ^= 0xff
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+
+		_, err = archiver.Restore(ctx, path)
+		assert.True(t, errors.Is(err, archive.ErrArchiveCorrupted))
+		assert.Empty(t, store.saved)
+	})
+}
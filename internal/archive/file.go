@@ -0,0 +1,163 @@
+package archive
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"order-service/internal/models"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// fileWriter пишет заказы в файл NDJSON, сжатый zstd, попутно считая sha256
+type fileWriter struct {
+	path  string
+	file  *os.File
+	sum   hash.Hash
+	count *countingWriter
+	enc   *zstd.Encoder
+	json  *json.Encoder
+	uids  []string
+	// versions версии записанных заказов: удаляются только неизмененные
+	versions map[string]int64
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func createFile(path string) (*fileWriter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.New()
+	count := &countingWriter{w: io.MultiWriter(file, sum)}
+	enc, err := zstd.NewWriter(count)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &fileWriter{
+		path:  path,
+		file:  file,
+		sum:   sum,
+		count: count,
+		enc:   enc,
+		json:  json.NewEncoder(enc),
+
+		versions: make(map[string]int64),
+	}, nil
+}
+
+// write добавляет заказ отдельной строкой
+func (f *fileWriter) write(order *models.Order) error {
+	if err := f.json.Encode(order); err != nil {
+		return err
+	}
+	f.uids = append(f.uids, order.OrderUID)
+	f.versions[order.OrderUID] = order.Version
+	return nil
+}
+
+// close дописывает сжатый поток, синхронизирует файл на диск и возвращает его описание
+func (f *fileWriter) close() (FileInfo, error) {
+	if err := f.enc.Close(); err != nil {
+		f.file.Close()
+		return FileInfo{}, err
+	}
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return FileInfo{}, err
+	}
+	if err := f.file.Close(); err != nil {
+		return FileInfo{}, err
+	}
+
+	return FileInfo{
+		Orders: len(f.uids),
+		Bytes:  f.count.n,
+		SHA256: hex.EncodeToString(f.sum.Sum(nil)),
+	}, nil
+}
+
+// readFile проверяет контрольную сумму файла (если info задан)
+// и передает в fn заказы в порядке записи
+func readFile(path string, info *FileInfo, fn func(order *models.Order) error) error {
+	if info != nil {
+		if err := verifyChecksum(path, info); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dec, err := zstd.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
+
+	scanner := bufio.NewScanner(dec)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		var order models.Order
+		if err := json.Unmarshal(scanner.Bytes(), &order); err != nil {
+			return fmt.Errorf("%s: строка %d: %w", path, line, err)
+		}
+		if err := fn(&order); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if info != nil && line != info.Orders {
+		return fmt.Errorf("%w: %s содержит %d заказов, в манифесте %d", ErrArchiveCorrupted, path, line, info.Orders)
+	}
+
+	return nil
+}
+
+func verifyChecksum(path string, info *FileInfo) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sum := sha256.New()
+	n, err := io.Copy(sum, file)
+	if err != nil {
+		return err
+	}
+
+	if n != info.Bytes || hex.EncodeToString(sum.Sum(nil)) != info.SHA256 {
+		return fmt.Errorf("%w: %s не совпадает с манифестом", ErrArchiveCorrupted, path)
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const manifestPattern = "manifest-*.json"
+
+// Manifest описание одного запуска архивации
+type Manifest struct {
+	CreatedAt time.Time  `json:"created_at"`
+	Cutoff    time.Time  `json:"cutoff"`
+	Orders    int        `json:"orders"`
+	Files     []FileInfo `json:"files"`
+}
+
+// FileInfo файл архива: число заказов, размер и sha256 сжатого файла
+type FileInfo struct {
+	Name   string `json:"name"`
+	Orders int    `json:"orders"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+	// Заказы файла удалены из бд после проверки
+	Deleted bool `json:"deleted"`
+	// Заказы, измененные после выгрузки: они остались в бд, а копия в файле устарела
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+func writeManifest(path string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func readManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+// findFileInfo ищет описание файла архива в манифестах его каталога
+func findFileInfo(path string) (*FileInfo, error) {
+	manifests, err := filepath.Glob(filepath.Join(filepath.Dir(path), manifestPattern))
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(path)
+	for _, manifestPath := range manifests {
+		manifest, err := readManifest(manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		for i := range manifest.Files {
+			if manifest.Files[i].Name == name {
+				return &manifest.Files[i], nil
+			}
+		}
+	}
+
+	return nil, errors.New("файл не найден ни в одном манифесте")
+}
@@ -0,0 +1,91 @@
+// Package audit описывает журнал изменений заказов: кто изменил заказ
+// (источник берется из контекста) и что именно поменялось.
+package audit
+
+import (
+	"context"
+	"time"
+)
+
+// Операции над заказом
+const (
+	OpInsert = "insert"
+	OpUpdate = "update"
+	OpDelete = "delete"
+	// Обезличивание персональных данных покупателя
+	OpErase = "erase"
+)
+
+// Типы источников изменений
+const (
+	SourceKafka   = "kafka"
+	SourceHTTP    = "http"
+	SourceAdmin   = "admin"
+	SourceCLI     = "cli"
+	SourceSystem  = "system"
+	SourceUnknown = "unknown"
+)
+
+// Source кто или что изменило заказ
+type Source struct {
+	Type string `json:"type"`
+	// Сообщение Kafka, из которого пришло изменение
+	Kafka *KafkaPosition `json:"kafka,omitempty"`
+	// Адрес HTTP-клиента и пользователь, если он известен
+	Client string `json:"client,omitempty"`
+	User   string `json:"user,omitempty"`
+	// Уточнение: команда CLI, фоновая задача и т.п.
+	Detail string `json:"detail,omitempty"`
+}
+
+type KafkaPosition struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// Entry запись журнала
+type Entry struct {
+	ID        int64             `json:"id"`
+	OrderUID  string            `json:"order_uid"`
+	Operation string            `json:"operation"`
+	Source    Source            `json:"source"`
+	Changes   map[string]Change `json:"changes,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type sourceKey struct{}
+
+type orderSourcesKey struct{}
+
+// WithSource задает источник для всех изменений в ctx
+func WithSource(ctx context.Context, source Source) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// WithOrderSources задает источники отдельных заказов пачки по order_uid;
+// для остальных заказов действует источник из WithSource
+func WithOrderSources(ctx context.Context, sources map[string]Source) context.Context {
+	return context.WithValue(ctx, orderSourcesKey{}, sources)
+}
+
+// SourceFrom возвращает источник из ctx и признак, что он задан
+func SourceFrom(ctx context.Context) (Source, bool) {
+	source, ok := ctx.Value(sourceKey{}).(Source)
+	return source, ok
+}
+
+// SourceFor возвращает источник изменения заказа orderUID
+func SourceFor(ctx context.Context, orderUID string) Source {
+	if sources, ok := ctx.Value(orderSourcesKey{}).(map[string]Source); ok {
+		if source, ok := sources[orderUID]; ok {
+			return source
+		}
+	}
+
+	if source, ok := SourceFrom(ctx); ok {
+		return source
+	}
+
+	return Source{Type: SourceUnknown}
+}
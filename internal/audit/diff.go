@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Change значение поля до и после изменения (nil - поля не было)
+type Change struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// Diff сравнивает JSON-представления before и after (любое может быть nil)
+// и возвращает изменившиеся поля по путям вида "delivery.city", "items[0].price".
+func Diff(before, after any) (map[string]Change, error) {
+	beforeFields, err := flatten(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := flatten(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]Change)
+	for path, value := range beforeFields {
+		if other, ok := afterFields[path]; !ok || !reflect.DeepEqual(value, other) {
+			changes[path] = Change{Before: value, After: other}
+		}
+	}
+	for path, value := range afterFields {
+		if _, ok := beforeFields[path]; !ok {
+			changes[path] = Change{After: value}
+		}
+	}
+
+	return changes, nil
+}
+
+// flatten раскладывает JSON-представление v в плоскую карту путь -> значение
+func flatten(v any) (map[string]any, error) {
+	fields := make(map[string]any)
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil() {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree any
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+
+	flattenInto(fields, "", tree)
+	return fields, nil
+}
+
+func flattenInto(fields map[string]any, prefix string, v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flattenInto(fields, path, value)
+		}
+	case []any:
+		for i, value := range v {
+			flattenInto(fields, fmt.Sprintf("%s[%d]", prefix, i), value)
+		}
+	default:
+		fields[prefix] = v
+	}
+}
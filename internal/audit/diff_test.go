@@ -0,0 +1,51 @@
+package audit_test
+
+import (
+	"testing"
+
+	"order-service/internal/audit"
+	"order-service/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	before := &models.Order{
+		OrderUID: "order1",
+		Delivery: models.Delivery{City: "Kiryat Mozkin"},
+		Items:    []models.Item{{ChrtID: 1, Price: 453}},
+	}
+
+	t.Run("update", func(t *testing.T) {
+		after := before.Clone()
+		after.Delivery.City = "Haifa"
+		after.Items[0].Price = 500
+		after.Items = append(after.Items, models.Item{ChrtID: 2})
+
+		changes, err := audit.Diff(before, after)
+		require.NoError(t, err)
+
+		assert.Equal(t, audit.Change{Before: "Kiryat Mozkin", After: "Haifa"}, changes["delivery.city"])
+		assert.Equal(t, audit.Change{Before: 453.0, After: 500.0}, changes["items[0].price"])
+		assert.Equal(t, audit.Change{After: 2.0}, changes["items[1].chrt_id"])
+		assert.NotContains(t, changes, "order_uid")
+	})
+
+	t.Run("insert and delete", func(t *testing.T) {
+		inserted, err := audit.Diff(nil, before)
+		require.NoError(t, err)
+		assert.Equal(t, audit.Change{After: "order1"}, inserted["order_uid"])
+
+		var none *models.Order
+		deleted, err := audit.Diff(before, none)
+		require.NoError(t, err)
+		assert.Equal(t, audit.Change{Before: "order1"}, deleted["order_uid"])
+	})
+
+	t.Run("no changes", func(t *testing.T) {
+		changes, err := audit.Diff(before, before.Clone())
+		require.NoError(t, err)
+		assert.Empty(t, changes)
+	})
+}
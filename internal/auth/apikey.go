@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// APIKey статический ключ API. Сам ключ не хранится, только его sha256.
+type APIKey struct {
+	Name   string   `json:"name"`
+	SHA256 string   `json:"key_sha256"`
+	Scopes []string `json:"scopes"`
+}
+
+// HashAPIKey возвращает sha256 ключа в hex, как в файле ключей
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadAPIKeys читает JSON-массив ключей из файла
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("разбор ключей API %s: %w", path, err)
+	}
+
+	for i, key := range keys {
+		hash, err := hex.DecodeString(key.SHA256)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("ключ API %q: key_sha256 должен быть sha256 в hex", key.Name)
+		}
+		if key.Name == "" {
+			return nil, fmt.Errorf("ключ API #%d: не задано имя", i+1)
+		}
+		keys[i].SHA256 = strings.ToLower(key.SHA256)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signJWT подписывает claims ключом key с заголовком alg/kid
+func signJWT(t *testing.T, key *rsa.PrivateKey, alg, kid string, claims map[string]any) string {
+	t.Helper()
+
+	encode := func(v any) string {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	unsigned := encode(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestAuthenticate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	a := NewAuthenticator(
+		WithAPIKeys([]APIKey{{Name: "web", SHA256: HashAPIKey("secret"), Scopes: []string{ScopeOrdersRead}}}),
+		WithJWKS(JWKS{"k1": &key.PublicKey}, "https://issuer", "order-service"),
+	)
+	a.now = func() time.Time { return now }
+
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{
+			"sub": "operator", "iss": "https://issuer", "aud": []string{"order-service"},
+			"exp": now.Add(time.Hour).Unix(), "scope": "orders:read support",
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+	authenticate := func(header, value string) (*Principal, error) {
+		r := httptest.NewRequest("GET", "/order/1", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		return a.Authenticate(r)
+	}
+
+	t.Run("no credentials", func(t *testing.T) {
+		principal, err := authenticate("", "")
+		require.NoError(t, err)
+		assert.Nil(t, principal)
+	})
+
+	t.Run("api key", func(t *testing.T) {
+		principal, err := authenticate("X-API-Key", "secret")
+		require.NoError(t, err)
+		assert.Equal(t, "web", principal.Subject)
+		assert.True(t, principal.HasScope(ScopeOrdersRead))
+		assert.False(t, principal.HasScope(ScopeOrdersWrite))
+		assert.Equal(t, RoleAnonymous, principal.Role())
+
+		_, err = authenticate("X-API-Key", "wrong")
+		assert.ErrorIs(t, err, ErrUnauthenticated)
+	})
+
+	t.Run("jwt", func(t *testing.T) {
+		principal, err := authenticate("Authorization", "Bearer "+signJWT(t, key, "RS256", "k1", claims(nil)))
+		require.NoError(t, err)
+		assert.Equal(t, "operator", principal.Subject)
+		assert.Equal(t, MethodJWT, principal.Method)
+		assert.Equal(t, RoleSupport, principal.Role())
+	})
+
+	t.Run("rejected tokens", func(t *testing.T) {
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+
+		tokens := map[string]string{
+			"expired":      signJWT(t, key, "RS256", "k1", claims(map[string]any{"exp": now.Add(-time.Hour).Unix()})),
+			"no exp":       signJWT(t, key, "RS256", "k1", claims(map[string]any{"exp": nil})),
+			"not yet":      signJWT(t, key, "RS256", "k1", claims(map[string]any{"nbf": now.Add(time.Hour).Unix()})),
+			"wrong iss":    signJWT(t, key, "RS256", "k1", claims(map[string]any{"iss": "https://other"})),
+			"wrong aud":    signJWT(t, key, "RS256", "k1", claims(map[string]any{"aud": "other"})),
+			"unknown kid":  signJWT(t, key, "RS256", "k2", claims(nil)),
+			"foreign key":  signJWT(t, other, "RS256", "k1", claims(nil)),
+			"alg mismatch": signJWT(t, key, "HS256", "k1", claims(nil)),
+			"garbage":      "not.a.token",
+		}
+		for name, token := range tokens {
+			_, err := authenticate("Authorization", "Bearer "+token)
+			assert.ErrorIs(t, err, ErrUnauthenticated, name)
+		}
+
+		_, err = authenticate("Authorization", "Basic dXNlcjpwYXNz")
+		assert.ErrorIs(t, err, ErrUnauthenticated)
+	})
+
+	t.Run("principal in context", func(t *testing.T) {
+		ctx := WithPrincipal(context.Background(), &Principal{Subject: "root", Scopes: []string{ScopeAdmin}})
+
+		principal, ok := PrincipalFrom(ctx)
+		require.True(t, ok)
+		assert.True(t, principal.HasScope(ScopeOrdersWrite), "admin дает все права")
+		assert.Equal(t, RoleAdmin, RoleFrom(ctx))
+		assert.Equal(t, RoleAnonymous, RoleFrom(context.Background()))
+	})
+}
+
+func TestLoadJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwks := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "k1", "alg": "RS256", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())},
+		{"kty": "EC", "kid": "k2"},
+	}}
+	data, err := json.Marshal(jwks)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	loaded, err := LoadJWKS(path)
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	assert.True(t, key.PublicKey.Equal(loaded["k1"]))
+}
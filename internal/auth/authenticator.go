@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrUnauthenticated учетные данные переданы, но не приняты
+var ErrUnauthenticated = errors.New("неверные учетные данные")
+
+// Authenticator проверяет ключи API из заголовка X-API-Key
+// и JWT из Authorization: Bearer
+type Authenticator struct {
+	apiKeys  []APIKey
+	jwks     JWKS
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+type Option func(a *Authenticator)
+
+// WithAPIKeys задает статические ключи API
+func WithAPIKeys(keys []APIKey) Option {
+	return func(a *Authenticator) {
+		a.apiKeys = keys
+	}
+}
+
+// WithJWKS включает JWT: подпись проверяется ключами jwks, iss и aud
+// сверяются с issuer и audience, если они не пустые
+func WithJWKS(jwks JWKS, issuer, audience string) Option {
+	return func(a *Authenticator) {
+		a.jwks = jwks
+		a.issuer = issuer
+		a.audience = audience
+	}
+}
+
+func NewAuthenticator(opts ...Option) *Authenticator {
+	a := &Authenticator{now: time.Now}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Enabled true, если задан хотя бы один способ аутентификации
+func (a *Authenticator) Enabled() bool {
+	return len(a.apiKeys) > 0 || len(a.jwks) > 0
+}
+
+// Authenticate возвращает вызывающего по заголовкам запроса.
+// Без учетных данных возвращает nil, nil; неверные дают ErrUnauthenticated.
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return a.checkAPIKey(key)
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		return nil, nil
+	}
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || len(a.jwks) == 0 {
+		return nil, ErrUnauthenticated
+	}
+
+	principal, err := a.verifyJWT(strings.TrimSpace(token))
+	if err != nil {
+		return nil, errors.Join(ErrUnauthenticated, err)
+	}
+	return principal, nil
+}
+
+// checkAPIKey сравнивает хэш со всеми ключами за постоянное время
+func (a *Authenticator) checkAPIKey(key string) (*Principal, error) {
+	hash := []byte(HashAPIKey(key))
+
+	var found *APIKey
+	for i := range a.apiKeys {
+		if subtle.ConstantTimeCompare(hash, []byte(a.apiKeys[i].SHA256)) == 1 {
+			found = &a.apiKeys[i]
+		}
+	}
+	if found == nil {
+		return nil, ErrUnauthenticated
+	}
+
+	return &Principal{Subject: found.Name, Method: MethodAPIKey, Scopes: found.Scopes}, nil
+}
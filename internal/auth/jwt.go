@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// clockSkew допустимое расхождение часов при проверке exp и nbf
+const clockSkew = time.Minute
+
+// JWKS открытые ключи RS256 по kid
+type JWKS map[string]*rsa.PublicKey
+
+type jwksFile struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Alg string `json:"alg"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// LoadJWKS читает ключи RSA из файла JWKS. Ключи других типов
+// и назначений пропускаются.
+func LoadJWKS(path string) (JWKS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file jwksFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("разбор JWKS %s: %w", path, err)
+	}
+
+	keys := make(JWKS)
+	for _, k := range file.Keys {
+		if k.Kty != "RSA" || (k.Alg != "" && k.Alg != "RS256") || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("ключ %q в JWKS %s: неверные n или e", k.Kid, path)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("в JWKS %s нет ключей RS256", path)
+	}
+
+	return keys, nil
+}
+
+var errInvalidToken = errors.New("недействительный токен")
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *int64   `json:"exp"`
+	NotBefore *int64   `json:"nbf"`
+	// Права через пробел, как в OAuth 2.0
+	Scope string `json:"scope"`
+}
+
+// audience aud бывает строкой или массивом строк
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// verifyJWT проверяет подпись RS256, срок действия, iss и aud (если заданы)
+func (a *Authenticator) verifyJWT(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: неверный формат", errInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	// Только RS256: alg из токена не должен выбирать алгоритм проверки
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: алгоритм %q не поддерживается", errInvalidToken, header.Alg)
+	}
+
+	key, ok := a.jwks[header.Kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: неизвестный kid %q", errInvalidToken, header.Kid)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: неверная подпись", errInvalidToken)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("%w: неверная подпись", errInvalidToken)
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := a.checkClaims(&claims); err != nil {
+		return nil, err
+	}
+
+	return &Principal{Subject: claims.Subject, Method: MethodJWT, Scopes: strings.Fields(claims.Scope)}, nil
+}
+
+func (a *Authenticator) checkClaims(claims *jwtClaims) error {
+	now := a.now()
+	if claims.ExpiresAt == nil || now.After(time.Unix(*claims.ExpiresAt, 0).Add(clockSkew)) {
+		return fmt.Errorf("%w: срок действия истек", errInvalidToken)
+	}
+	if claims.NotBefore != nil && now.Add(clockSkew).Before(time.Unix(*claims.NotBefore, 0)) {
+		return fmt.Errorf("%w: токен еще не действует", errInvalidToken)
+	}
+	if a.issuer != "" && claims.Issuer != a.issuer {
+		return fmt.Errorf("%w: неверный iss", errInvalidToken)
+	}
+	if a.audience != "" && !slices.Contains(claims.Audience, a.audience) {
+		return fmt.Errorf("%w: неверный aud", errInvalidToken)
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: неверная кодировка", errInvalidToken)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: неверный JSON", errInvalidToken)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+// Права доступа к API
+const (
+	ScopeOrdersRead  = "orders:read"
+	ScopeOrdersWrite = "orders:write"
+	// support видит персональные данные с меньшим маскированием
+	ScopeSupport = "support"
+	// admin дает все права
+	ScopeAdmin = "admin"
+)
+
+// Способы аутентификации
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// Principal аутентифицированный вызывающий
+type Principal struct {
+	// Имя API-ключа или sub из JWT
+	Subject string
+	Method  string
+	Scopes  []string
+}
+
+// HasScope проверяет право; admin дает любое
+func (p *Principal) HasScope(scope string) bool {
+	if p == nil {
+		return false
+	}
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// Role роль для маскирования персональных данных
+func (p *Principal) Role() Role {
+	switch {
+	case p.HasScope(ScopeAdmin):
+		return RoleAdmin
+	case p.HasScope(ScopeSupport):
+		return RoleSupport
+	default:
+		return RoleAnonymous
+	}
+}
+
+type principalKey struct{}
+
+// WithPrincipal сохраняет в ctx вызывающего и его роль
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	ctx = context.WithValue(ctx, principalKey{}, p)
+	return WithRole(ctx, p.Role())
+}
+
+// PrincipalFrom возвращает вызывающего; false - запрос анонимный
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
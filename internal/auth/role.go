@@ -0,0 +1,27 @@
+package auth
+
+import "context"
+
+// Role уровень доступа вызывающего к персональным данным
+type Role string
+
+const (
+	RoleAnonymous Role = "anonymous"
+	RoleSupport   Role = "support"
+	RoleAdmin     Role = "admin"
+)
+
+type roleKey struct{}
+
+// WithRole сохраняет в ctx роль вызывающего
+func WithRole(ctx context.Context, role Role) context.Context {
+	return context.WithValue(ctx, roleKey{}, role)
+}
+
+// RoleFrom возвращает роль вызывающего; без нее - RoleAnonymous
+func RoleFrom(ctx context.Context) Role {
+	if role, ok := ctx.Value(roleKey{}).(Role); ok {
+		return role
+	}
+	return RoleAnonymous
+}
@@ -0,0 +1,189 @@
+// Package codec сериализует заказы в форматы, которые клиент запрашивает
+// через Accept (JSON, MessagePack, Protobuf), и сжимает ответы
+// по Accept-Encoding (zstd, gzip).
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"strconv"
+	"strings"
+
+	"order-service/internal/models"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var (
+	// ErrUnsupportedFormat формат не поддерживается или не подходит для значения
+	ErrUnsupportedFormat = errors.New("неподдерживаемый формат")
+)
+
+// Format формат тела запроса или ответа
+type Format string
+
+const (
+	JSON     Format = "json"
+	MsgPack  Format = "msgpack"
+	Protobuf Format = "protobuf"
+)
+
+// Formats все форматы в порядке предпочтения сервера
+var Formats = []Format{JSON, MsgPack, Protobuf}
+
+// mediaTypes типы содержимого форматов; первый - основной, остальные
+// принимаются в Accept и Content-Type как синонимы
+var mediaTypes = map[Format][]string{
+	JSON:     {"application/json"},
+	MsgPack:  {"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"},
+	Protobuf: {"application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf"},
+}
+
+// ContentType основной тип содержимого формата
+func (f Format) ContentType() string {
+	return mediaTypes[f][0]
+}
+
+// FromContentType определяет формат тела запроса. Без Content-Type - JSON.
+func FromContentType(contentType string) (Format, bool) {
+	if strings.TrimSpace(contentType) == "" {
+		return JSON, true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+	for _, f := range Formats {
+		for _, t := range mediaTypes[f] {
+			if mediaType == t {
+				return f, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Negotiate выбирает из offered (по умолчанию - Formats) формат с наибольшим
+// q в Accept; при равных q - идущий раньше в offered. Пустой Accept - первый
+// из offered. false, если клиент не принимает ни один.
+func Negotiate(accept string, offered ...Format) (Format, bool) {
+	if len(offered) == 0 {
+		offered = Formats
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offered[0], true
+	}
+
+	ranges := parseAccept(accept)
+	var best Format
+	bestQ := 0.0
+	for _, f := range offered {
+		if q := formatQuality(ranges, f); q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+
+	return best, bestQ > 0
+}
+
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		ranges = append(ranges, mediaRange{mediaType: mediaType, q: parseQuality(params["q"])})
+	}
+	return ranges
+}
+
+// formatQuality q формата по самому точному подходящему диапазону:
+// type/subtype точнее type/*, а тот - */*
+func formatQuality(ranges []mediaRange, f Format) float64 {
+	q, specificity := 0.0, 0
+	for _, r := range ranges {
+		for _, t := range mediaTypes[f] {
+			s := matchSpecificity(r.mediaType, t)
+			if s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+	}
+	return q
+}
+
+func matchSpecificity(mediaRange, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 3
+	case mediaRange == "*/*":
+		return 1
+	case strings.HasSuffix(mediaRange, "/*") &&
+		strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+		return 2
+	}
+	return 0
+}
+
+// parseQuality разбирает q; без q - 1, некорректный - 0
+func parseQuality(value string) float64 {
+	if value == "" {
+		return 1
+	}
+	q, err := strconv.ParseFloat(value, 64)
+	if err != nil || q < 0 || q > 1 {
+		return 0
+	}
+	return q
+}
+
+// Marshal сериализует v в формат f. Protobuf поддерживается только для *models.Order.
+func Marshal(f Format, v any) ([]byte, error) {
+	switch f {
+	case JSON:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case MsgPack:
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetCustomStructTag("json")
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Protobuf:
+		order, ok := v.(*models.Order)
+		if !ok {
+			return nil, ErrUnsupportedFormat
+		}
+		return marshalOrderProto(order), nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// UnmarshalOrder разбирает заказ из data в формате f
+func UnmarshalOrder(f Format, data []byte, order *models.Order) error {
+	switch f {
+	case JSON:
+		return json.Unmarshal(data, order)
+	case MsgPack:
+		dec := msgpack.NewDecoder(bytes.NewReader(data))
+		dec.SetCustomStructTag("json")
+		return dec.Decode(order)
+	case Protobuf:
+		return unmarshalOrderProto(data, order)
+	}
+	return ErrUnsupportedFormat
+}
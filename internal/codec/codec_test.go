@@ -0,0 +1,125 @@
+package codec_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"order-service/internal/codec"
+	"order-service/internal/models"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testOrder() *models.Order {
+	return &models.Order{
+		OrderUID: "b563feb7b2b84b6test", TrackNumber: "WBILMTESTTRACK", Entry: "WBIL",
+		Delivery: models.Delivery{
+			Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction: "b563feb7b2b84b6test", Currency: "USD", Provider: "wbpay", Amount: 1817,
+			PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317,
+		},
+		Items: []models.Item{
+			{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, Rid: "ab4219087a764ae0btest",
+				Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202},
+			{ChrtID: 1, Price: 1, Rid: "r2", Name: "Brush", Size: "0", NmID: 2, Brand: "b", Status: 202},
+		},
+		Locale: "en", CustomerID: "test", DeliveryService: "meest", Shardkey: "9", SmID: 99,
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC), OofShard: "1",
+		Version: 3, UpdatedAt: time.Date(2026, 10, 19, 12, 0, 0, 123000, time.UTC),
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, f := range codec.Formats {
+		t.Run(string(f), func(t *testing.T) {
+			data, err := codec.Marshal(f, testOrder())
+			require.NoError(t, err)
+
+			var got models.Order
+			require.NoError(t, codec.UnmarshalOrder(f, data, &got))
+			// MessagePack возвращает время в локальной зоне
+			got.DateCreated, got.UpdatedAt = got.DateCreated.UTC(), got.UpdatedAt.UTC()
+			assert.Equal(t, testOrder(), &got)
+		})
+	}
+
+	t.Run("protobuf only for orders", func(t *testing.T) {
+		_, err := codec.Marshal(codec.Protobuf, []string{"x"})
+		assert.ErrorIs(t, err, codec.ErrUnsupportedFormat)
+	})
+
+	t.Run("protobuf is smaller than json", func(t *testing.T) {
+		jsonData, _ := codec.Marshal(codec.JSON, testOrder())
+		protoData, _ := codec.Marshal(codec.Protobuf, testOrder())
+		assert.Less(t, len(protoData), len(jsonData))
+	})
+
+	t.Run("truncated protobuf", func(t *testing.T) {
+		data, _ := codec.Marshal(codec.Protobuf, testOrder())
+		var got models.Order
+		assert.Error(t, codec.UnmarshalOrder(codec.Protobuf, data[:len(data)-3], &got))
+	})
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept  string
+		offered []codec.Format
+		want    codec.Format
+		ok      bool
+	}{
+		{"", nil, codec.JSON, true},
+		{"*/*", nil, codec.JSON, true},
+		{"application/x-msgpack", nil, codec.MsgPack, true},
+		{"application/protobuf, application/json;q=0.5", nil, codec.Protobuf, true},
+		{"application/*;q=0.2, application/msgpack", nil, codec.MsgPack, true},
+		{"application/json;q=0, */*", nil, codec.MsgPack, true},
+		{"text/html", nil, "", false},
+		{"application/x-protobuf", []codec.Format{codec.JSON, codec.MsgPack}, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := codec.Negotiate(tt.accept, tt.offered...)
+		assert.Equal(t, tt.ok, ok, tt.accept)
+		assert.Equal(t, tt.want, got, tt.accept)
+	}
+
+	f, ok := codec.FromContentType("application/json; charset=utf-8")
+	assert.True(t, ok)
+	assert.Equal(t, codec.JSON, f)
+	_, ok = codec.FromContentType("text/plain")
+	assert.False(t, ok)
+}
+
+func TestCompression(t *testing.T) {
+	assert.Equal(t, codec.Zstd, codec.NegotiateEncoding("gzip, deflate, br, zstd"))
+	assert.Equal(t, codec.Gzip, codec.NegotiateEncoding("zstd;q=0.5, gzip"))
+	assert.Equal(t, codec.Gzip, codec.NegotiateEncoding("*, zstd;q=0"))
+	assert.Empty(t, codec.NegotiateEncoding("br"))
+	assert.Empty(t, codec.NegotiateEncoding(""))
+
+	data := bytes.Repeat([]byte(`{"order_uid":"b563feb7b2b84b6test"}`), 50)
+
+	compressed, err := codec.Compress(data, codec.Gzip)
+	require.NoError(t, err)
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	plain, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, data, plain)
+
+	compressed, err = codec.Compress(data, codec.Zstd)
+	require.NoError(t, err)
+	dec, err := zstd.NewReader(nil)
+	require.NoError(t, err)
+	plain, err = dec.DecodeAll(compressed, nil)
+	require.NoError(t, err)
+	assert.Equal(t, data, plain)
+}
@@ -0,0 +1,85 @@
+package codec
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Поддерживаемые кодировки содержимого
+const (
+	Zstd = "zstd"
+	Gzip = "gzip"
+)
+
+// MinCompressSize тела меньше этого размера не сжимаются: выигрыш
+// не окупает заголовки и время на сжатие
+const MinCompressSize = 512
+
+// encodings в порядке предпочтения сервера
+var encodings = []string{Zstd, Gzip}
+
+// zstdEncoder общий на все запросы: EncodeAll безопасен для параллельных вызовов
+var zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+	return zstd.NewWriter(nil)
+})
+
+// NegotiateEncoding выбирает кодировку с наибольшим q в Accept-Encoding,
+// при равных q предпочитается zstd. Пустая строка - без сжатия.
+func NegotiateEncoding(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+	for _, coding := range encodings {
+		if q := encodingQuality(acceptEncoding, coding); q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// encodingQuality q кодировки: точное совпадение важнее "*"
+func encodingQuality(acceptEncoding, coding string) float64 {
+	q, exact := 0.0, false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			quality = parseQuality(value)
+		}
+
+		switch {
+		case name == coding:
+			q, exact = quality, true
+		case name == "*" && !exact:
+			q = quality
+		}
+	}
+	return q
+}
+
+// Compress сжимает data кодировкой coding (Zstd или Gzip)
+func Compress(data []byte, coding string) ([]byte, error) {
+	switch coding {
+	case Zstd:
+		enc, err := zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return enc.EncodeAll(data, make([]byte, 0, len(data)/2)), nil
+	case Gzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, ErrUnsupportedFormat
+}
@@ -0,0 +1,296 @@
+package codec
+
+import (
+	"fmt"
+	"time"
+
+	"order-service/internal/models"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Номера полей соответствуют order.proto
+
+func marshalOrderProto(o *models.Order) []byte {
+	var b []byte
+	b = appendString(b, 1, o.OrderUID)
+	b = appendString(b, 2, o.TrackNumber)
+	b = appendString(b, 3, o.Entry)
+	b = appendMessage(b, 4, marshalDeliveryProto(&o.Delivery))
+	b = appendMessage(b, 5, marshalPaymentProto(&o.Payment))
+	for i := range o.Items {
+		b = appendMessage(b, 6, marshalItemProto(&o.Items[i]))
+	}
+	b = appendString(b, 7, o.Locale)
+	b = appendString(b, 8, o.InternalSignature)
+	b = appendString(b, 9, o.CustomerID)
+	b = appendString(b, 10, o.DeliveryService)
+	b = appendString(b, 11, o.Shardkey)
+	b = appendInt(b, 12, int64(o.SmID))
+	b = appendTime(b, 13, o.DateCreated)
+	b = appendString(b, 14, o.OofShard)
+	b = appendInt(b, 15, o.Version)
+	b = appendTime(b, 16, o.UpdatedAt)
+	return b
+}
+
+func marshalDeliveryProto(d *models.Delivery) []byte {
+	var b []byte
+	b = appendString(b, 1, d.Name)
+	b = appendString(b, 2, d.Phone)
+	b = appendString(b, 3, d.Zip)
+	b = appendString(b, 4, d.City)
+	b = appendString(b, 5, d.Address)
+	b = appendString(b, 6, d.Region)
+	b = appendString(b, 7, d.Email)
+	return b
+}
+
+func marshalPaymentProto(p *models.Payment) []byte {
+	var b []byte
+	b = appendString(b, 1, p.Transaction)
+	b = appendString(b, 2, p.RequestID)
+	b = appendString(b, 3, p.Currency)
+	b = appendString(b, 4, p.Provider)
+	b = appendInt(b, 5, int64(p.Amount))
+	b = appendInt(b, 6, p.PaymentDt)
+	b = appendString(b, 7, p.Bank)
+	b = appendInt(b, 8, int64(p.DeliveryCost))
+	b = appendInt(b, 9, int64(p.GoodsTotal))
+	b = appendInt(b, 10, int64(p.CustomFee))
+	return b
+}
+
+func marshalItemProto(it *models.Item) []byte {
+	var b []byte
+	b = appendInt(b, 1, int64(it.ChrtID))
+	b = appendString(b, 2, it.TrackNumber)
+	b = appendInt(b, 3, int64(it.Price))
+	b = appendString(b, 4, it.Rid)
+	b = appendString(b, 5, it.Name)
+	b = appendInt(b, 6, int64(it.Sale))
+	b = appendString(b, 7, it.Size)
+	b = appendInt(b, 8, int64(it.TotalPrice))
+	b = appendInt(b, 9, int64(it.NmID))
+	b = appendString(b, 10, it.Brand)
+	b = appendInt(b, 11, int64(it.Status))
+	return b
+}
+
+// Значения по умолчанию (пустая строка, 0, нулевое время) не пишутся, как в proto3
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// appendTime пишет google.protobuf.Timestamp
+func appendTime(b []byte, num protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	var ts []byte
+	ts = appendInt(ts, 1, t.Unix())
+	ts = appendInt(ts, 2, int64(t.Nanosecond()))
+	return appendMessage(b, num, ts)
+}
+
+// protoField поле сообщения. Поля с неожиданным wire type читаются
+// как значения по умолчанию.
+type protoField struct {
+	num    protowire.Number
+	varint uint64
+	bytes  []byte
+}
+
+func (f protoField) str() string { return string(f.bytes) }
+func (f protoField) int() int64  { return int64(f.varint) }
+
+// decodeFields вызывает fn для каждого поля сообщения, неизвестные поля пропускаются
+func decodeFields(b []byte, fn func(f protoField) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("protobuf: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		f := protoField{num: num}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("protobuf: поле %d: %w", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unmarshalOrderProto(b []byte, o *models.Order) error {
+	return decodeFields(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			o.OrderUID = f.str()
+		case 2:
+			o.TrackNumber = f.str()
+		case 3:
+			o.Entry = f.str()
+		case 4:
+			return unmarshalDeliveryProto(f.bytes, &o.Delivery)
+		case 5:
+			return unmarshalPaymentProto(f.bytes, &o.Payment)
+		case 6:
+			var it models.Item
+			if err := unmarshalItemProto(f.bytes, &it); err != nil {
+				return err
+			}
+			o.Items = append(o.Items, it)
+		case 7:
+			o.Locale = f.str()
+		case 8:
+			o.InternalSignature = f.str()
+		case 9:
+			o.CustomerID = f.str()
+		case 10:
+			o.DeliveryService = f.str()
+		case 11:
+			o.Shardkey = f.str()
+		case 12:
+			o.SmID = int(f.int())
+		case 13:
+			return unmarshalTimeProto(f.bytes, &o.DateCreated)
+		case 14:
+			o.OofShard = f.str()
+		case 15:
+			o.Version = f.int()
+		case 16:
+			return unmarshalTimeProto(f.bytes, &o.UpdatedAt)
+		}
+		return nil
+	})
+}
+
+func unmarshalDeliveryProto(b []byte, d *models.Delivery) error {
+	return decodeFields(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			d.Name = f.str()
+		case 2:
+			d.Phone = f.str()
+		case 3:
+			d.Zip = f.str()
+		case 4:
+			d.City = f.str()
+		case 5:
+			d.Address = f.str()
+		case 6:
+			d.Region = f.str()
+		case 7:
+			d.Email = f.str()
+		}
+		return nil
+	})
+}
+
+func unmarshalPaymentProto(b []byte, p *models.Payment) error {
+	return decodeFields(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			p.Transaction = f.str()
+		case 2:
+			p.RequestID = f.str()
+		case 3:
+			p.Currency = f.str()
+		case 4:
+			p.Provider = f.str()
+		case 5:
+			p.Amount = int(f.int())
+		case 6:
+			p.PaymentDt = f.int()
+		case 7:
+			p.Bank = f.str()
+		case 8:
+			p.DeliveryCost = int(f.int())
+		case 9:
+			p.GoodsTotal = int(f.int())
+		case 10:
+			p.CustomFee = int(f.int())
+		}
+		return nil
+	})
+}
+
+func unmarshalItemProto(b []byte, it *models.Item) error {
+	return decodeFields(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			it.ChrtID = int(f.int())
+		case 2:
+			it.TrackNumber = f.str()
+		case 3:
+			it.Price = int(f.int())
+		case 4:
+			it.Rid = f.str()
+		case 5:
+			it.Name = f.str()
+		case 6:
+			it.Sale = int(f.int())
+		case 7:
+			it.Size = f.str()
+		case 8:
+			it.TotalPrice = int(f.int())
+		case 9:
+			it.NmID = int(f.int())
+		case 10:
+			it.Brand = f.str()
+		case 11:
+			it.Status = int(f.int())
+		}
+		return nil
+	})
+}
+
+func unmarshalTimeProto(b []byte, t *time.Time) error {
+	var seconds, nanos int64
+	err := decodeFields(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			seconds = f.int()
+		case 2:
+			nanos = f.int()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	*t = time.Unix(seconds, nanos).UTC()
+	return nil
+}
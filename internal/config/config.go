@@ -3,9 +3,13 @@ package config
 import (
 	"fmt"
 	"log"
+	"maps"
+	"math"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,17 +17,94 @@ import (
 type Config struct {
 	// HTTP
 	HTTP_ADDR string
+	// Файл с хэшами ключей API и файл JWKS для проверки JWT (пусто - способ выключен)
+	APIKeysFile string
+	JWKSFile    string
+	// Ожидаемые iss и aud в JWT (пусто - не проверяются)
+	JWTIssuer   string
+	JWTAudience string
+	// Разрешить чтение заказа без аутентификации (с маскированием персональных данных)
+	AuthAllowAnonymous bool
+	// Token bucket на клиента: запросов в секунду (0 - без ограничения) и запас
+	RateLimitRPS   float64
+	RateLimitBurst int
+	// Неудачных попыток аутентификации с одного адреса в минуту (0 - без ограничения)
+	AuthFailuresPerMinute float64
+	// IP и CIDR прокси, которым можно верить в X-Forwarded-For
+	TrustedProxies string
+	// Максимальный размер тела и заголовков запроса, срок чтения заголовков
+	HTTPMaxBodyBytes      int64
+	HTTPMaxHeaderBytes    int
+	HTTPReadHeaderTimeout time.Duration
+	// Сроки чтения запроса, записи ответа и простоя keep-alive соединения
+	HTTPReadTimeout  time.Duration
+	HTTPWriteTimeout time.Duration
+	HTTPIdleTimeout  time.Duration
 
 	// Database
 	DatabaseURL string
+	// Реплики для чтения (пусто - все запросы в primary), период их проверки
+	// и окно после записи, в которое заказ читается из primary
+	DatabaseReplicaURLs          []string
+	DatabaseReplicaCheckInterval time.Duration
+	DatabaseReadYourWrites       time.Duration
+	// Пул соединений (для каждой бд: primary, реплики, шарды)
+	DatabaseMaxConns          int
+	DatabaseMinConns          int
+	DatabaseMaxConnLifetime   time.Duration
+	DatabaseMaxConnIdleTime   time.Duration
+	DatabaseHealthCheckPeriod time.Duration
+	// statement_timeout сессий и application_name (видно в pg_stat_activity)
+	DatabaseStatementTimeout time.Duration
+	DatabaseApplicationName  string
+	// Сроки операций с одним заказом и загрузки списков заказов
+	DatabaseQueryTimeout     time.Duration
+	DatabaseBulkQueryTimeout time.Duration
+	// Шарды "имя=DSN" и карта shardkey по ним ("0-4=s1,5-9=s2").
+	// Если шарды заданы, DB_URL и реплики не используются.
+	DatabaseShards   map[string]string
+	DatabaseShardMap string
+	// Накатывать миграции при старте сервера
+	AutoMigrate bool
+	// Обслуживание месячных секций orders/items
+	PartitionInterval    time.Duration
+	PartitionMonthsAhead int
+	OrderRetention       time.Duration // 0 - хранить всегда
+	PartitionDetachOnly  bool          // старые секции только отсоединять
+	// Каталог архива старых заказов и число заказов в одном файле
+	ArchiveDir              string
+	ArchiveMaxOrdersPerFile int
+	// Файл keyring для шифрования персональных данных доставки (пусто - не шифровать)
+	PIIKeyringFile string
 
 	// Kafka
 	KafkaBrokers []string
 	KafkaTopic   string
 	KafkaGroupID string
+	// Размер микро-пачки (1 - по одному сообщению) и максимальное ожидание ее заполнения
+	KafkaBatchSize    int
+	KafkaBatchTimeout time.Duration
+	// Топик синхронизации кэшей между инстансами (пусто - выключено)
+	KafkaCacheTopic string
+	// Топик событий order.accepted из outbox (пусто - ретрансляция выключена)
+	KafkaAcceptedTopic string
+	// Опрос outbox и срок хранения отправленных событий (0 - всегда)
+	OutboxPollInterval time.Duration
+	OutboxBatchSize    int
+	OutboxRetention    time.Duration
 
 	// Cache
 	CacheCapacity int
+	// Файл снапшота кэша (пусто - выключено) и период его сохранения
+	CacheSnapshotPath     string
+	CacheSnapshotInterval time.Duration
+	// Срок жизни записи (0 - бессрочно) и окно фонового обновления перед устареванием
+	CacheTTL            time.Duration
+	CacheRefreshAhead   time.Duration
+	CacheRefreshWorkers int
+
+	// Идентификатор инстанса, по умолчанию имя хоста
+	InstanceID string
 }
 
 func Load() (*Config, error) {
@@ -39,12 +120,69 @@ func Load() (*Config, error) {
 	if cfg.HTTP_ADDR == "" {
 		return nil, fmt.Errorf("HTTP_ADDR is required")
 	}
+	cfg.APIKeysFile = os.Getenv("API_KEYS_FILE")
+	cfg.JWKSFile = os.Getenv("JWKS_FILE")
+	cfg.JWTIssuer = os.Getenv("JWT_ISSUER")
+	cfg.JWTAudience = os.Getenv("JWT_AUDIENCE")
+	cfg.AuthAllowAnonymous = getBool("AUTH_ALLOW_ANONYMOUS", false)
+	cfg.RateLimitRPS = getNonNegativeFloat("RATE_LIMIT_RPS", 10)
+	cfg.RateLimitBurst = getPositiveInt("RATE_LIMIT_BURST", 20)
+	cfg.AuthFailuresPerMinute = getNonNegativeFloat("AUTH_FAILURES_PER_MINUTE", 10)
+	cfg.TrustedProxies = os.Getenv("TRUSTED_PROXIES")
+	cfg.HTTPMaxBodyBytes = int64(getPositiveInt("HTTP_MAX_BODY_BYTES", 1<<20))
+	cfg.HTTPMaxHeaderBytes = getPositiveInt("HTTP_MAX_HEADER_BYTES", 64<<10)
+	cfg.HTTPReadHeaderTimeout = getDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second)
+	cfg.HTTPReadTimeout = getDuration("HTTP_READ_TIMEOUT", 15*time.Second)
+	cfg.HTTPWriteTimeout = getDuration("HTTP_WRITE_TIMEOUT", 30*time.Second)
+	cfg.HTTPIdleTimeout = getDuration("HTTP_IDLE_TIMEOUT", 60*time.Second)
 
 	// Database
 	cfg.DatabaseURL = os.Getenv("DB_URL")
-	if cfg.DatabaseURL == "" {
+	if shards := os.Getenv("DB_SHARDS"); shards != "" {
+		cfg.DatabaseShards = make(map[string]string)
+		for _, shard := range strings.Split(shards, ",") {
+			name, dsn, ok := strings.Cut(shard, "=")
+			if !ok || name == "" || dsn == "" {
+				return nil, fmt.Errorf("invalid DB_SHARDS entry %q, expected name=dsn", shard)
+			}
+			cfg.DatabaseShards[strings.TrimSpace(name)] = strings.TrimSpace(dsn)
+		}
+
+		cfg.DatabaseShardMap = os.Getenv("DB_SHARD_MAP")
+		if cfg.DatabaseShardMap == "" {
+			return nil, fmt.Errorf("DB_SHARD_MAP is required when DB_SHARDS is set")
+		}
+	} else if cfg.DatabaseURL == "" {
 		return nil, fmt.Errorf("DB_URL is required")
 	}
+	if replicas := os.Getenv("DB_REPLICA_URLS"); replicas != "" {
+		cfg.DatabaseReplicaURLs = strings.Split(replicas, ",")
+	}
+	cfg.DatabaseReplicaCheckInterval = getDuration("DB_REPLICA_CHECK_INTERVAL", 5*time.Second)
+	cfg.DatabaseReadYourWrites = getDuration("DB_READ_YOUR_WRITES_WINDOW", 5*time.Second)
+	cfg.DatabaseMaxConns = getPositiveInt("DB_MAX_CONNS", 10)
+	cfg.DatabaseMinConns = getPositiveInt("DB_MIN_CONNS", 1)
+	cfg.DatabaseMaxConnLifetime = getDuration("DB_MAX_CONN_LIFETIME", time.Hour)
+	cfg.DatabaseMaxConnIdleTime = getDuration("DB_MAX_CONN_IDLE_TIME", 30*time.Minute)
+	cfg.DatabaseHealthCheckPeriod = getDuration("DB_HEALTH_CHECK_PERIOD", time.Minute)
+	cfg.DatabaseStatementTimeout = getDuration("DB_STATEMENT_TIMEOUT", 30*time.Second)
+	cfg.DatabaseApplicationName = os.Getenv("DB_APPLICATION_NAME")
+	if cfg.DatabaseApplicationName == "" {
+		cfg.DatabaseApplicationName = "order-service"
+	}
+	cfg.DatabaseQueryTimeout = getDuration("DB_QUERY_TIMEOUT", 5*time.Second)
+	cfg.DatabaseBulkQueryTimeout = getDuration("DB_BULK_QUERY_TIMEOUT", 5*time.Minute)
+	cfg.AutoMigrate = getBool("AUTO_MIGRATE", false)
+	cfg.PartitionInterval = getDuration("PARTITION_MAINTENANCE_INTERVAL", time.Hour)
+	cfg.PartitionMonthsAhead = getPositiveInt("PARTITION_MONTHS_AHEAD", 3)
+	cfg.OrderRetention = getDuration("ORDER_RETENTION", 0)
+	cfg.PartitionDetachOnly = getBool("PARTITION_DETACH_ONLY", false)
+	cfg.ArchiveDir = os.Getenv("ARCHIVE_DIR")
+	if cfg.ArchiveDir == "" {
+		cfg.ArchiveDir = "archive"
+	}
+	cfg.ArchiveMaxOrdersPerFile = getPositiveInt("ARCHIVE_MAX_ORDERS_PER_FILE", 10000)
+	cfg.PIIKeyringFile = os.Getenv("PII_KEYRING_FILE")
 
 	// Kafka
 	kafkaBrokers := os.Getenv("KAFKA_BROKERS")
@@ -59,6 +197,13 @@ func Load() (*Config, error) {
 	}
 
 	cfg.KafkaGroupID = os.Getenv("KAFKA_GROUP_ID")
+	cfg.KafkaCacheTopic = os.Getenv("KAFKA_CACHE_TOPIC")
+	cfg.KafkaAcceptedTopic = os.Getenv("KAFKA_ACCEPTED_TOPIC")
+	cfg.OutboxPollInterval = getDuration("OUTBOX_POLL_INTERVAL", time.Second)
+	cfg.OutboxBatchSize = getPositiveInt("OUTBOX_BATCH_SIZE", 100)
+	cfg.OutboxRetention = getDuration("OUTBOX_RETENTION", 7*24*time.Hour)
+	cfg.KafkaBatchSize = getPositiveInt("KAFKA_BATCH_SIZE", 1)
+	cfg.KafkaBatchTimeout = getDuration("KAFKA_BATCH_TIMEOUT", 100*time.Millisecond)
 
 	// Cache
 	cacheCapacity := 1000
@@ -72,5 +217,105 @@ func Load() (*Config, error) {
 		}
 	}
 	cfg.CacheCapacity = cacheCapacity
+	cfg.CacheSnapshotPath = os.Getenv("CACHE_SNAPSHOT_PATH")
+	cfg.CacheSnapshotInterval = getDuration("CACHE_SNAPSHOT_INTERVAL", 5*time.Minute)
+	cfg.CacheTTL = getDuration("CACHE_TTL", 0)
+	cfg.CacheRefreshAhead = getDuration("CACHE_REFRESH_AHEAD", 0)
+	cfg.CacheRefreshWorkers = getPositiveInt("CACHE_REFRESH_WORKERS", 4)
+	if cfg.CacheRefreshAhead > 0 && cfg.CacheRefreshAhead >= cfg.CacheTTL {
+		return nil, fmt.Errorf("CACHE_REFRESH_AHEAD (%s) must be less than CACHE_TTL (%s)", cfg.CacheRefreshAhead, cfg.CacheTTL)
+	}
+
+	// Instance
+	cfg.InstanceID = os.Getenv("INSTANCE_ID")
+	if cfg.InstanceID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("INSTANCE_ID is not set and hostname is unavailable: %w", err)
+		}
+		cfg.InstanceID = hostname
+	}
+
 	return cfg, nil
 }
+
+// DatabaseURLs возвращает DSN всех бд сервиса: шардов или единственной DB_URL
+func (c *Config) DatabaseURLs() []string {
+	if len(c.DatabaseShards) == 0 {
+		return []string{c.DatabaseURL}
+	}
+
+	urls := make([]string, 0, len(c.DatabaseShards))
+	for _, name := range slices.Sorted(maps.Keys(c.DatabaseShards)) {
+		urls = append(urls, c.DatabaseShards[name])
+	}
+	return urls
+}
+
+// getDuration читает длительность вида "30s" из переменной окружения,
+// при пустом или некорректном значении возвращает def
+func getDuration(key string, def time.Duration) time.Duration {
+	envVal := os.Getenv(key)
+	if envVal == "" {
+		return def
+	}
+
+	val, err := time.ParseDuration(envVal)
+	if err != nil || val < 0 {
+		log.Printf("Invalid %s '%s', using default: %s", key, envVal, def)
+		return def
+	}
+
+	return val
+}
+
+// getPositiveInt читает положительное целое из переменной окружения,
+// при пустом или некорректном значении возвращает def
+func getPositiveInt(key string, def int) int {
+	envVal := os.Getenv(key)
+	if envVal == "" {
+		return def
+	}
+
+	val, err := strconv.Atoi(envVal)
+	if err != nil || val <= 0 {
+		log.Printf("Invalid %s '%s', using default: %d", key, envVal, def)
+		return def
+	}
+
+	return val
+}
+
+// getNonNegativeFloat читает неотрицательное число из переменной окружения,
+// при пустом или некорректном значении возвращает def
+func getNonNegativeFloat(key string, def float64) float64 {
+	envVal := os.Getenv(key)
+	if envVal == "" {
+		return def
+	}
+
+	val, err := strconv.ParseFloat(envVal, 64)
+	if err != nil || val < 0 || math.IsInf(val, 0) || math.IsNaN(val) {
+		log.Printf("Invalid %s '%s', using default: %g", key, envVal, def)
+		return def
+	}
+
+	return val
+}
+
+// getBool читает флаг из переменной окружения ("true", "1", ...),
+// при пустом или некорректном значении возвращает def
+func getBool(key string, def bool) bool {
+	envVal := os.Getenv(key)
+	if envVal == "" {
+		return def
+	}
+
+	val, err := strconv.ParseBool(envVal)
+	if err != nil {
+		log.Printf("Invalid %s '%s', using default: %t", key, envVal, def)
+		return def
+	}
+
+	return val
+}
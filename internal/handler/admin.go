@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"order-service/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) CacheStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.service.CacheStats())
+}
+
+// CacheKeys отдает ключи кэша от недавно использованных к давно использованным
+func (h *Handler) CacheKeys(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		val, err := strconv.Atoi(raw)
+		if err != nil || val < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = val
+	}
+
+	writeJSON(w, http.StatusOK, h.service.CacheKeys(limit))
+}
+
+func (h *Handler) EvictOrder(w http.ResponseWriter, r *http.Request) {
+	h.service.EvictOrder(mux.Vars(r)["id"])
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) EvictAll(w http.ResponseWriter, r *http.Request) {
+	h.service.EvictAll()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) StartRewarm(w http.ResponseWriter, r *http.Request) {
+	progress, err := h.service.StartRewarm()
+	if errors.Is(err, service.ErrRewarmInProgress) {
+		writeJSON(w, http.StatusConflict, progress)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, progress)
+}
+
+func (h *Handler) RewarmProgress(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.service.RewarmProgress())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// EraseCustomer обезличивает данные покупателя; ?dry_run=true только показывает затронутые заказы
+func (h *Handler) EraseCustomer(w http.ResponseWriter, r *http.Request) {
+	dryRun := false
+	if raw := r.URL.Query().Get("dry_run"); raw != "" {
+		val, err := strconv.ParseBool(raw)
+		if err != nil {
+			http.Error(w, "Invalid dry_run", http.StatusBadRequest)
+			return
+		}
+		dryRun = val
+	}
+
+	result, err := h.service.EraseCustomer(r.Context(), mux.Vars(r)["id"], dryRun)
+	if errors.Is(err, service.ErrCustomerIDRequired) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка обезличивания покупателя: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// FindOrders ищет заказы по email и/или телефону доставки:
+// GET /admin/orders?email=...&phone=...
+func (h *Handler) FindOrders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	uids, err := h.service.FindOrders(r.Context(), query.Get("email"), query.Get("phone"))
+	if errors.Is(err, service.ErrContactRequired) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка поиска заказов по контактам: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if uids == nil {
+		uids = []string{}
+	}
+
+	writeJSON(w, http.StatusOK, uids)
+}
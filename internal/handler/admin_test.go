@@ -0,0 +1,68 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"order-service/internal/handler"
+	"order-service/internal/models"
+	"order-service/internal/repository"
+	"order-service/internal/repository/mocks"
+	"order-service/internal/service"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewarmEndpoints(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockOrderRepository(ctrl)
+	repo.EXPECT().GetAllOrders(gomock.Any()).Return(map[string]*models.Order{}, nil)
+	h := handler.New(service.New(repo, repository.NewCache(10)))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/cache/rewarm", h.StartRewarm).Methods("POST")
+	router.HandleFunc("/admin/cache/rewarm", h.RewarmProgress).Methods("GET")
+
+	call := func(method string) (int, service.RewarmProgress) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, "/admin/cache/rewarm", nil))
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var progress service.RewarmProgress
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&progress))
+		return w.Code, progress
+	}
+
+	release := make(chan struct{})
+	repo.EXPECT().ListOrderUIDs(gomock.Any()).DoAndReturn(func(ctx context.Context) ([]string, error) {
+		<-release
+		return []string{"order1"}, nil
+	})
+	repo.EXPECT().GetOrder(gomock.Any(), "order1").Return(&models.Order{OrderUID: "order1"}, nil)
+
+	status, progress := call("POST")
+	assert.Equal(t, http.StatusAccepted, status)
+	assert.True(t, progress.Running)
+
+	status, _ = call("POST")
+	assert.Equal(t, http.StatusConflict, status)
+
+	status, progress = call("GET")
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, progress.Running)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		_, progress = call("GET")
+		return !progress.Running
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 1, progress.Total)
+	assert.Equal(t, 1, progress.Loaded)
+}
@@ -0,0 +1,89 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"order-service/internal/audit"
+	"order-service/internal/auth"
+	"order-service/internal/handler"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func testAuthenticator() *auth.Authenticator {
+	return auth.NewAuthenticator(auth.WithAPIKeys([]auth.APIKey{
+		{Name: "reader", SHA256: auth.HashAPIKey("reader-key"), Scopes: []string{auth.ScopeOrdersRead}},
+		{Name: "ops", SHA256: auth.HashAPIKey("admin-key"), Scopes: []string{auth.ScopeAdmin}},
+	}))
+}
+
+func TestAuthenticate(t *testing.T) {
+	var principal *auth.Principal
+	var source audit.Source
+	var hasSource bool
+	router := mux.NewRouter()
+	router.Use(handler.Authenticate(testAuthenticator()))
+	router.HandleFunc("/order/{id}", func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = auth.PrincipalFrom(r.Context())
+		source, hasSource = audit.SourceFrom(r.Context())
+	})
+
+	t.Run("anonymous request passes without principal", func(t *testing.T) {
+		w := serve(router, "/order/1", "203.0.113.1:5000", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Nil(t, principal)
+		assert.False(t, hasSource)
+	})
+
+	t.Run("invalid credentials are rejected", func(t *testing.T) {
+		principal = nil
+		w := serve(router, "/order/1", "203.0.113.1:5000", "guess")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+		assert.Nil(t, principal, "обработчик не вызывается")
+
+		r := httptest.NewRequest("GET", "/order/1", nil)
+		r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("changes are attributed to the principal", func(t *testing.T) {
+		w := serve(router, "/order/1", "203.0.113.1:5000", "reader-key")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "reader", principal.Subject)
+		assert.True(t, hasSource)
+		assert.Equal(t, audit.Source{Type: audit.SourceHTTP, Client: "203.0.113.1:5000", User: "reader"}, source)
+
+		serve(router, "/order/1", "203.0.113.1:5000", "admin-key")
+		assert.Equal(t, audit.Source{Type: audit.SourceAdmin, Client: "203.0.113.1:5000", User: "ops"}, source)
+	})
+}
+
+func TestRequireScope(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(handler.Authenticate(testAuthenticator()))
+	router.Handle("/order/{id}", handler.RequireScope(auth.ScopeOrdersWrite)(http.HandlerFunc(okHandler)))
+	router.Handle("/read/{id}", handler.RequireScope(auth.ScopeOrdersRead)(http.HandlerFunc(okHandler)))
+
+	cases := []struct {
+		name   string
+		path   string
+		key    string
+		status int
+	}{
+		{name: "anonymous", path: "/order/1", status: http.StatusUnauthorized},
+		{name: "missing scope", path: "/order/1", key: "reader-key", status: http.StatusForbidden},
+		{name: "admin has every scope", path: "/order/1", key: "admin-key", status: http.StatusOK},
+		{name: "matching scope", path: "/read/1", key: "reader-key", status: http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.status, serve(router, tc.path, "203.0.113.1:5000", tc.key).Code)
+		})
+	}
+}
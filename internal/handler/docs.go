@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"net/http"
+
+	"order-service/internal/openapi"
+)
+
+// OpenAPISpec отдает описание API в формате OpenAPI 3
+func (h *Handler) OpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openapi.Spec)
+}
+
+// APIDocs отдает страницу просмотра описания API
+func (h *Handler) APIDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(openapi.Viewer)
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// orderCacheControl ответ можно хранить только в кэше клиента
+// и только с перепроверкой через If-None-Match
+const orderCacheControl = "private, no-cache"
+
+// orderETag строгий ETag представления: версия заказа и хэш тела.
+// Версия нужна для If-Match, хэш различает представления одной версии
+// (с разной маскировкой, в разных форматах и кодировках).
+func orderETag(version int64, hash string) string {
+	return `"` + strconv.FormatInt(version, 10) + "-" + hash + `"`
+}
+
+// parseVersionETag достает версию заказа из значения If-Match.
+// Принимает ETag из orderETag и прежний формат "<версия>".
+func parseVersionETag(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return 0, fmt.Errorf("invalid ETag %q", value)
+	}
+
+	tag := value[1 : len(value)-1]
+	if i := strings.IndexByte(tag, '-'); i >= 0 {
+		tag = tag[:i]
+	}
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("invalid ETag %q", value)
+	}
+
+	return version, nil
+}
+
+// setOrderCacheHeaders выставляет заголовки валидации кэша для ответа с заказом
+func setOrderCacheHeaders(w http.ResponseWriter, etag string, updatedAt time.Time) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", orderCacheControl)
+	if !updatedAt.IsZero() {
+		w.Header().Set("Last-Modified", updatedAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified проверяет условные заголовки GET. If-Modified-Since
+// учитывается только без If-None-Match (RFC 9110, 13.1.3).
+func notModified(r *http.Request, etag string, updatedAt time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagListMatches(inm, etag)
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || updatedAt.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !updatedAt.Truncate(time.Second).After(since)
+}
+
+// etagListMatches слабое сравнение etag со списком из If-None-Match
+func etagListMatches(list, etag string) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
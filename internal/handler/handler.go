@@ -1,10 +1,18 @@
 package handler
 
 import (
-	"encoding/json"
+	"errors"
+	"io"
+	"log"
 	"net/http"
 
+	"order-service/internal/audit"
+	"order-service/internal/auth"
+	"order-service/internal/codec"
+	"order-service/internal/models"
+	"order-service/internal/repository"
 	"order-service/internal/service"
+	"order-service/internal/view"
 
 	"github.com/gorilla/mux"
 )
@@ -26,14 +34,155 @@ func (h *Handler) GetOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order, err := h.service.GetOrder(r.Context(), orderUID)
+	w.Header().Set("Vary", varyHeaders)
+	rep, ok := negotiate(r)
+	if !ok {
+		notAcceptable(w)
+		return
+	}
+
+	// Персональные данные маскируются по роли вызывающего, поэтому готовое
+	// тело кэшируется отдельно для каждой роли, формата и сжатия
+	role := auth.RoleFrom(r.Context())
+	order, enc, err := h.service.GetOrderEncoded(r.Context(), orderUID, rep.cacheKey(role),
+		func(order *models.Order) (repository.EncodedOrder, error) {
+			return rep.encode(view.Order(order, role))
+		})
+	if errors.Is(err, repository.ErrOrderNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
+		log.Printf("Ошибка получения заказа %s: %v", orderUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	etag := orderETag(order.Version, enc.Hash)
+	setOrderCacheHeaders(w, etag, order.UpdatedAt)
+	if notModified(r, etag, order.UpdatedAt) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeEncoded(w, rep, enc, http.StatusOK)
+}
+
+// UpdateOrder перезаписывает заказ. Требует If-Match с ETag, полученным из GET,
+// чтобы не затереть чужое изменение.
+func (h *Handler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
+	orderUID := mux.Vars(r)["id"]
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		http.Error(w, "If-Match header is required", http.StatusPreconditionRequired)
+		return
+	}
+	expectedVersion, err := parseVersionETag(ifMatch)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, ok := codec.FromContentType(r.Header.Get("Content-Type"))
+	if !ok {
+		http.Error(w, "Unsupported Content-Type", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Vary", varyHeaders)
+	rep, ok := negotiate(r)
+	if !ok {
+		notAcceptable(w)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	var order models.Order
+	if err := codec.UnmarshalOrder(format, body, &order); err != nil {
+		http.Error(w, "Invalid "+string(format)+" body", http.StatusBadRequest)
+		return
+	}
+	if order.OrderUID != "" && order.OrderUID != orderUID {
+		http.Error(w, "order_uid does not match URL", http.StatusBadRequest)
+		return
+	}
+	order.OrderUID = orderUID
+
+	// Аутентифицированного вызывающего в журнал записывает Authenticate
+	ctx := r.Context()
+	if _, ok := audit.SourceFrom(ctx); !ok {
+		ctx = audit.WithSource(ctx, audit.Source{Type: audit.SourceHTTP, Client: r.RemoteAddr})
+	}
+
+	err = h.service.UpdateOrder(ctx, &order, expectedVersion)
+	switch {
+	case errors.Is(err, service.ErrInvalidOrder),
+		errors.Is(err, repository.ErrShardKeyChanged),
+		errors.Is(err, repository.ErrUnknownShard):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, repository.ErrOrderNotFound):
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
+	case errors.Is(err, repository.ErrVersionConflict):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	case err != nil:
+		log.Printf("Ошибка обновления заказа %s: %v", orderUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(order)
+	// Ответ маскируется и кодируется так же, как в GetOrder, и получает такой же ETag
+	enc, err := rep.encode(view.Order(&order, auth.RoleFrom(ctx)))
+	if err != nil {
+		log.Printf("Ошибка сериализации заказа %s: %v", orderUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	setOrderCacheHeaders(w, orderETag(order.Version, enc.Hash), order.UpdatedAt)
+	writeEncoded(w, rep, enc, http.StatusOK)
+}
+
+// OrderAudit отдает журнал изменений заказа в JSON или MessagePack
+func (h *Handler) OrderAudit(w http.ResponseWriter, r *http.Request) {
+	orderUID := mux.Vars(r)["id"]
+
+	w.Header().Set("Vary", varyHeaders)
+	rep, ok := negotiate(r, codec.JSON, codec.MsgPack)
+	if !ok {
+		notAcceptable(w, codec.JSON, codec.MsgPack)
+		return
+	}
+
+	entries, err := h.service.OrderAudit(r.Context(), orderUID)
+	if err != nil {
+		log.Printf("Ошибка чтения журнала заказа %s: %v", orderUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(entries) == 0 {
+		http.Error(w, "Order audit not found", http.StatusNotFound)
+		return
+	}
+
+	enc, err := rep.encode(entries)
+	if err != nil {
+		log.Printf("Ошибка сериализации журнала заказа %s: %v", orderUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeEncoded(w, rep, enc, http.StatusOK)
 }
 
 func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
@@ -42,6 +191,7 @@ func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
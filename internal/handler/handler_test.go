@@ -0,0 +1,140 @@
+package handler_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"order-service/internal/codec"
+	"order-service/internal/handler"
+	"order-service/internal/models"
+	"order-service/internal/repository"
+	"order-service/internal/repository/mocks"
+	"order-service/internal/service"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/klauspost/compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRouter возвращает роутер с GET /order/{id}, в кэше которого лежат orders
+func newTestRouter(t *testing.T, orders ...*models.Order) *mux.Router {
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockOrderRepository(ctrl)
+	repo.EXPECT().GetAllOrders(gomock.Any()).Return(map[string]*models.Order{}, nil)
+
+	// Кэш заполняется после New: при старте сервис восстанавливает его из бд
+	cache := repository.NewCache(10)
+	svc := service.New(repo, cache)
+	for _, order := range orders {
+		cache.Set(order)
+	}
+
+	h := handler.New(svc)
+	router := mux.NewRouter()
+	router.HandleFunc("/order/{id}", h.GetOrder).Methods("GET")
+	return router
+}
+
+func TestGetOrderConditional(t *testing.T) {
+	updatedAt := time.Date(2026, 10, 19, 12, 0, 0, 500, time.UTC)
+	router := newTestRouter(t, &models.Order{
+		OrderUID: "order1", Version: 3, UpdatedAt: updatedAt,
+		Delivery: models.Delivery{Phone: "+9720000000"},
+	})
+
+	get := func(header, value string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/order/order1", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	first := get("", "")
+	require.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	assert.Regexp(t, `^"3-[0-9a-f]{16}"$`, etag)
+	assert.Equal(t, "Mon, 19 Oct 2026 12:00:00 GMT", first.Header().Get("Last-Modified"))
+	assert.Equal(t, "private, no-cache", first.Header().Get("Cache-Control"))
+	assert.NotContains(t, first.Body.String(), "+9720000000", "анонимный ответ маскируется")
+
+	second := get("", "")
+	assert.Equal(t, etag, second.Header().Get("ETag"))
+	assert.Equal(t, first.Body.String(), second.Body.String())
+
+	t.Run("if-none-match", func(t *testing.T) {
+		w := get("If-None-Match", `"1-0000000000000000", W/`+etag)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+
+		w = get("If-None-Match", `"2-0000000000000000"`)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("if-modified-since", func(t *testing.T) {
+		w := get("If-Modified-Since", updatedAt.Format(http.TimeFormat))
+		assert.Equal(t, http.StatusNotModified, w.Code)
+
+		w = get("If-Modified-Since", updatedAt.Add(-time.Second).Format(http.TimeFormat))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestGetOrderNegotiation(t *testing.T) {
+	order := &models.Order{OrderUID: "order1", Version: 1, Delivery: models.Delivery{City: "Kiryat Mozkin"}}
+	for range 10 {
+		order.Items = append(order.Items, models.Item{Name: "Mascaras", Brand: "Vivienne Sabo", Rid: "ab4219087a764ae0btest"})
+	}
+	router := newTestRouter(t, order)
+
+	get := func(accept, acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/order/order1", nil)
+		r.Header.Set("Accept", accept)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, f := range codec.Formats {
+		t.Run(string(f), func(t *testing.T) {
+			w := get(f.ContentType(), "")
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, f.ContentType(), w.Header().Get("Content-Type"))
+			assert.Empty(t, w.Header().Get("Content-Encoding"))
+
+			var got models.Order
+			require.NoError(t, codec.UnmarshalOrder(f, w.Body.Bytes(), &got))
+			assert.Equal(t, "order1", got.OrderUID)
+			assert.Len(t, got.Items, 10)
+		})
+	}
+
+	t.Run("not acceptable", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotAcceptable, get("text/html", "").Code)
+	})
+
+	t.Run("gzip", func(t *testing.T) {
+		plain := get("", "")
+		w := get("", "gzip")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+		assert.Contains(t, w.Header().Get("Vary"), "Accept-Encoding")
+		assert.NotEqual(t, plain.Header().Get("ETag"), w.Header().Get("ETag"))
+
+		zr, err := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+		require.NoError(t, err)
+		body, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		assert.Equal(t, plain.Body.Bytes(), body)
+	})
+}
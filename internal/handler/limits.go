@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"order-service/internal/auth"
+	"order-service/internal/ratelimit"
+
+	"github.com/gorilla/mux"
+)
+
+// RateLimit ограничивает частоту запросов клиента: аутентифицированного -
+// по ключу API или sub токена, анонимного - по адресу (с учетом доверенных прокси).
+// Запросы к путям exempt (проверки здоровья) не ограничиваются.
+// Должен стоять после Authenticate.
+func RateLimit(l *ratelimit.Limiter, proxies ratelimit.TrustedProxies, exempt ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.Contains(exempt, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := "ip:" + proxies.ClientIP(r)
+			if principal, ok := auth.PrincipalFrom(r.Context()); ok {
+				key = principal.Method + ":" + principal.Subject
+			}
+
+			if ok, wait := l.Allow(key); !ok {
+				tooManyRequests(w, wait)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// LimitAuthFailures ограничивает подбор учетных данных: каждый ответ 401 на запрос
+// с X-API-Key или Authorization тратит токен адреса клиента в l, и пока токенов
+// нет, такие запросы с этого адреса получают 429 без проверки учетных данных.
+// Должен стоять перед Authenticate.
+func LimitAuthFailures(l *ratelimit.Limiter, proxies ratelimit.TrustedProxies) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-API-Key") == "" && r.Header.Get("Authorization") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := "auth-failure:" + proxies.ClientIP(r)
+			if ok, wait := l.Check(key); !ok {
+				tooManyRequests(w, wait)
+				return
+			}
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == http.StatusUnauthorized {
+				l.Allow(key)
+			}
+		})
+	}
+}
+
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many requests", http.StatusTooManyRequests)
+}
+
+// MaxBodySize ограничивает размер тела запроса; чтение сверх limit
+// возвращает *http.MaxBytesError
+func MaxBodySize(limit int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"order-service/internal/auth"
+	"order-service/internal/handler"
+	"order-service/internal/ratelimit"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// serve выполняет запрос с адреса remoteAddr и ключом API key (если задан)
+func serve(router http.Handler, path, remoteAddr, key string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", path, nil)
+	r.RemoteAddr = remoteAddr
+	if key != "" {
+		r.Header.Set("X-API-Key", key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestLimitAuthFailures(t *testing.T) {
+	authenticator := auth.NewAuthenticator(auth.WithAPIKeys([]auth.APIKey{
+		{Name: "reader", SHA256: auth.HashAPIKey("reader-key"), Scopes: []string{auth.ScopeOrdersRead}},
+	}))
+
+	router := mux.NewRouter()
+	router.Use(handler.LimitAuthFailures(ratelimit.New(1.0/60, 2), nil))
+	router.Use(handler.Authenticate(authenticator))
+	router.HandleFunc("/order/{id}", okHandler)
+
+	const attacker, other = "203.0.113.1:5000", "198.51.100.7:5000"
+
+	// Успешная аутентификация попыток не тратит
+	for range 3 {
+		assert.Equal(t, http.StatusOK, serve(router, "/order/1", attacker, "reader-key").Code)
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "/order/1", attacker, "guess-1").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "/order/1", attacker, "guess-2").Code)
+
+	w := serve(router, "/order/1", attacker, "reader-key")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "ключи с адреса больше не проверяются")
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// Анонимные запросы и другие адреса не затронуты
+	assert.Equal(t, http.StatusOK, serve(router, "/order/1", attacker, "").Code)
+	assert.Equal(t, http.StatusOK, serve(router, "/order/1", other, "reader-key").Code)
+}
+
+func TestRateLimitExempt(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(handler.RateLimit(ratelimit.New(1, 1), nil, "/health"))
+	router.HandleFunc("/health", okHandler)
+	router.HandleFunc("/order/{id}", okHandler)
+
+	const client = "203.0.113.1:5000"
+	for range 3 {
+		assert.Equal(t, http.StatusOK, serve(router, "/health", client, "").Code)
+	}
+
+	assert.Equal(t, http.StatusOK, serve(router, "/order/1", client, "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(router, "/order/1", client, "").Code)
+}
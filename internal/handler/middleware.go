@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"order-service/internal/auth"
+)
+
+// maxRequestIDLength более длинный X-Request-ID клиента заменяется своим
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDFrom возвращает идентификатор запроса из ctx
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestID берет X-Request-ID из запроса (или создает новый), кладет его
+// в ctx и возвращает в заголовке ответа
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID пропускает только печатные ASCII, чтобы id не ломал логи
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder запоминает статус и размер ответа для журнала запросов
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap дает http.ResponseController доступ к исходному ResponseWriter
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// AccessLog пишет по записи на запрос: метод, путь, статус, длительность,
+// размер ответа, id запроса и клиента. Строка запроса не пишется: в ней
+// бывают персональные данные (поиск по email и телефону).
+func AccessLog(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+
+			// Вызывающего определяет middleware глубже; сюда он возвращается через указатель
+			var principal *auth.Principal
+			r = r.WithContext(withPrincipalSlot(r.Context(), &principal))
+
+			next.ServeHTTP(rec, r)
+
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			attrs := []slog.Attr{
+				slog.String("request_id", RequestIDFrom(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.status),
+				slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.Int64("bytes", rec.bytes),
+				slog.String("remote", r.RemoteAddr),
+			}
+			if principal != nil {
+				attrs = append(attrs, slog.String("subject", principal.Subject))
+			}
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "http request", attrs...)
+		})
+	}
+}
+
+type principalSlotKey struct{}
+
+func withPrincipalSlot(ctx context.Context, slot **auth.Principal) context.Context {
+	return context.WithValue(ctx, principalSlotKey{}, slot)
+}
+
+// reportPrincipal сообщает журналу запросов вызывающего
+func reportPrincipal(ctx context.Context, principal *auth.Principal) {
+	if slot, ok := ctx.Value(principalSlotKey{}).(**auth.Principal); ok {
+		*slot = principal
+	}
+}
+
+// Recover превращает панику обработчика в ответ 500 с JSON-ошибкой.
+// http.ErrAbortHandler пробрасывается дальше: им обработчик прерывает ответ намеренно.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			requestID := RequestIDFrom(r.Context())
+			log.Printf("Паника при обработке %s %s (request_id %s): %v\n%s", r.Method, r.URL.Path, requestID, p, debug.Stack())
+			writeJSON(w, http.StatusInternalServerError, map[string]string{
+				"error":      "internal server error",
+				"request_id": requestID,
+			})
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
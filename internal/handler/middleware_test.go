@@ -0,0 +1,81 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"order-service/internal/handler"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	chain := func(h http.HandlerFunc) http.Handler {
+		logger := slog.New(slog.NewJSONHandler(&logs, nil))
+		return handler.RequestID(handler.AccessLog(logger)(handler.Recover(h)))
+	}
+
+	t.Run("request id is propagated", func(t *testing.T) {
+		var seen string
+		h := chain(func(w http.ResponseWriter, r *http.Request) {
+			seen = handler.RequestIDFrom(r.Context())
+		})
+
+		r := httptest.NewRequest("GET", "/order/1", nil)
+		r.Header.Set("X-Request-ID", "abc-123")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		assert.Equal(t, "abc-123", seen)
+		assert.Equal(t, "abc-123", w.Header().Get("X-Request-ID"))
+
+		r.Header.Set("X-Request-ID", "bad id\n")
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Len(t, w.Header().Get("X-Request-ID"), 32, "некорректный id заменяется")
+	})
+
+	t.Run("panic becomes 500 and is logged", func(t *testing.T) {
+		logs.Reset()
+		h := chain(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		})
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/order/1?email=test@gmail.com", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		var body map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, w.Header().Get("X-Request-ID"), body["request_id"])
+
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+		assert.Equal(t, "/order/1", entry["path"])
+		assert.Equal(t, float64(http.StatusInternalServerError), entry["status"])
+		assert.Equal(t, body["request_id"], entry["request_id"])
+		assert.NotContains(t, logs.String(), "test@gmail.com")
+	})
+
+	t.Run("status and size are logged", func(t *testing.T) {
+		logs.Reset()
+		h := chain(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("hello"))
+		})
+
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/x", nil))
+
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+		assert.Equal(t, float64(http.StatusCreated), entry["status"])
+		assert.Equal(t, float64(5), entry["bytes"])
+		assert.Equal(t, "POST", entry["method"])
+	})
+}
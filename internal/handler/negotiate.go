@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"order-service/internal/auth"
+	"order-service/internal/codec"
+	"order-service/internal/repository"
+)
+
+// etagHashLen сколько hex-символов хэша тела попадает в ETag
+const etagHashLen = 16
+
+// varyHeaders заголовки запроса, от которых зависит тело ответа с заказом
+const varyHeaders = "Authorization, X-API-Key, Accept, Accept-Encoding"
+
+// representation согласованное с клиентом представление ответа
+type representation struct {
+	format codec.Format
+	coding string // пусто - без сжатия
+}
+
+// negotiate выбирает формат из offered по Accept и сжатие по Accept-Encoding.
+// false, если клиент не принимает ни один из форматов.
+func negotiate(r *http.Request, offered ...codec.Format) (representation, bool) {
+	format, ok := codec.Negotiate(r.Header.Get("Accept"), offered...)
+	if !ok {
+		return representation{}, false
+	}
+	return representation{format: format, coding: codec.NegotiateEncoding(r.Header.Get("Accept-Encoding"))}, true
+}
+
+// cacheKey ключ представления в кэше закодированных заказов
+func (rep representation) cacheKey(role auth.Role) string {
+	return string(role) + "/" + string(rep.format) + "/" + rep.coding
+}
+
+// encode сериализует v, сжимает тело, если оно достаточно большое,
+// и считает хэш итоговых байт
+func (rep representation) encode(v any) (repository.EncodedOrder, error) {
+	data, err := codec.Marshal(rep.format, v)
+	if err != nil {
+		return repository.EncodedOrder{}, err
+	}
+
+	var encoding string
+	if rep.coding != "" && len(data) >= codec.MinCompressSize {
+		if data, err = codec.Compress(data, rep.coding); err != nil {
+			return repository.EncodedOrder{}, err
+		}
+		encoding = rep.coding
+	}
+
+	sum := sha256.Sum256(data)
+	return repository.EncodedOrder{
+		Data:     data,
+		Hash:     hex.EncodeToString(sum[:])[:etagHashLen],
+		Encoding: encoding,
+	}, nil
+}
+
+// writeEncoded пишет готовое тело с заголовками формата и сжатия
+func writeEncoded(w http.ResponseWriter, rep representation, enc repository.EncodedOrder, status int) {
+	w.Header().Set("Content-Type", rep.format.ContentType())
+	if enc.Encoding != "" {
+		w.Header().Set("Content-Encoding", enc.Encoding)
+	}
+	w.WriteHeader(status)
+	w.Write(enc.Data)
+}
+
+// notAcceptable отвечает 406 со списком поддерживаемых типов
+func notAcceptable(w http.ResponseWriter, offered ...codec.Format) {
+	if len(offered) == 0 {
+		offered = codec.Formats
+	}
+	types := make([]string, len(offered))
+	for i, f := range offered {
+		types[i] = f.ContentType()
+	}
+	http.Error(w, "Not Acceptable, supported: "+strings.Join(types, ", "), http.StatusNotAcceptable)
+}
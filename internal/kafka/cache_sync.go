@@ -0,0 +1,237 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"order-service/internal/models"
+	"order-service/internal/pii"
+	"order-service/internal/service"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	cacheOpUpsert = "upsert"
+	cacheOpEvict  = "evict"
+)
+
+// cacheEvent сообщение об изменении заказа в топике синхронизации кэшей
+type cacheEvent struct {
+	Op       string        `json:"op"`
+	OrderUID string        `json:"order_uid"`
+	Source   string        `json:"source"`
+	Order    *models.Order `json:"order,omitempty"`
+	// Envelope задан, если персональные поля доставки в Order зашифрованы
+	Envelope *pii.Envelope `json:"pii_envelope,omitempty"`
+}
+
+// CacheSyncOption настраивает публикацию и чтение топика синхронизации кэшей
+type CacheSyncOption func(c *cacheCipher)
+
+// WithCacheEncryption шифрует имя, телефон, адрес и email доставки в событиях
+// тем же keyring, что и бд. Задается и публикатору, и читателю.
+func WithCacheEncryption(keyring *pii.Keyring) CacheSyncOption {
+	return func(c *cacheCipher) {
+		c.keyring = keyring
+	}
+}
+
+// cacheCipher шифрует доставку в событиях синхронизации кэшей
+type cacheCipher struct {
+	keyring *pii.Keyring
+}
+
+func newCacheCipher(opts []CacheSyncOption) cacheCipher {
+	var c cacheCipher
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+func cacheAAD(orderUID string) string {
+	return "cache:" + orderUID
+}
+
+// seal шифрует доставку в событии, если задан keyring. Заказ копируется.
+func (c cacheCipher) seal(event *cacheEvent) error {
+	if c.keyring == nil || event.Order == nil {
+		return nil
+	}
+
+	order := *event.Order
+	d := order.Delivery
+	env, sealed, err := c.keyring.Seal(cacheAAD(event.OrderUID), d.Name, d.Phone, d.Address, d.Email)
+	if err != nil {
+		return fmt.Errorf("шифрование события кэша %s: %w", event.OrderUID, err)
+	}
+	order.Delivery.Name, order.Delivery.Phone, order.Delivery.Address, order.Delivery.Email =
+		sealed[0], sealed[1], sealed[2], sealed[3]
+
+	event.Order = &order
+	event.Envelope = &env
+	return nil
+}
+
+// open расшифровывает доставку в событии. Открытые события не меняются.
+func (c cacheCipher) open(event *cacheEvent) error {
+	if event.Envelope == nil || event.Order == nil {
+		return nil
+	}
+	if c.keyring == nil {
+		return fmt.Errorf("событие кэша %s зашифровано ключом %q, keyring не задан", event.OrderUID, event.Envelope.KeyID)
+	}
+
+	d := &event.Order.Delivery
+	opened, err := c.keyring.Open(*event.Envelope, cacheAAD(event.OrderUID), d.Name, d.Phone, d.Address, d.Email)
+	if err != nil {
+		return fmt.Errorf("расшифровка события кэша %s: %w", event.OrderUID, err)
+	}
+	d.Name, d.Phone, d.Address, d.Email = opened[0], opened[1], opened[2], opened[3]
+	event.Envelope = nil
+	return nil
+}
+
+// ChangePublisher публикует изменения заказов для остальных инстансов
+type ChangePublisher struct {
+	writer     *kafka.Writer
+	instanceID string
+	cipher     cacheCipher
+}
+
+var _ service.ChangeNotifier = (*ChangePublisher)(nil)
+
+func NewChangePublisher(brokers []string, topic string, instanceID string, opts ...CacheSyncOption) *ChangePublisher {
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: 10 * time.Millisecond,
+	}
+
+	return &ChangePublisher{
+		writer:     writer,
+		instanceID: instanceID,
+		cipher:     newCacheCipher(opts),
+	}
+}
+
+func (p *ChangePublisher) NotifyOrderChanged(ctx context.Context, order *models.Order) error {
+	event := cacheEvent{
+		Op:       cacheOpUpsert,
+		OrderUID: order.OrderUID,
+		Source:   p.instanceID,
+		Order:    order,
+	}
+	if err := p.cipher.seal(&event); err != nil {
+		return err
+	}
+	return p.publish(ctx, event)
+}
+
+// NotifyOrderEvicted просит остальные инстансы убрать заказ из кэша
+func (p *ChangePublisher) NotifyOrderEvicted(ctx context.Context, orderUID string) error {
+	return p.publish(ctx, cacheEvent{
+		Op:       cacheOpEvict,
+		OrderUID: orderUID,
+		Source:   p.instanceID,
+	})
+}
+
+func (p *ChangePublisher) publish(ctx context.Context, event cacheEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(event.OrderUID),
+		Value: data,
+	})
+}
+
+func (p *ChangePublisher) Close() error {
+	return p.writer.Close()
+}
+
+// CacheSync читает топик изменений и обновляет локальный кэш.
+// У каждого инстанса своя consumer group, чтобы событие получили все реплики.
+type CacheSync struct {
+	reader     *kafka.Reader
+	service    *service.Service
+	instanceID string
+	cipher     cacheCipher
+}
+
+func NewCacheSync(brokers []string, topic string, groupID string, instanceID string, svc *service.Service, opts ...CacheSyncOption) *CacheSync {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:        brokers,
+		Topic:          topic,
+		GroupID:        groupID + "-cache-" + instanceID,
+		StartOffset:    kafka.LastOffset, // кэш при старте уже восстановлен из бд
+		MaxBytes:       10e6,
+		CommitInterval: time.Second,
+	})
+
+	return &CacheSync{
+		reader:     reader,
+		service:    svc,
+		instanceID: instanceID,
+		cipher:     newCacheCipher(opts),
+	}
+}
+
+func (c *CacheSync) Start() {
+	log.Printf("Запуск синхронизации кэша, инстанс %s...", c.instanceID)
+
+	for {
+		msg, err := c.reader.ReadMessage(context.Background())
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return // ридер закрыт
+			}
+			log.Printf("Ошибка чтения события кэша: %v", err)
+			continue
+		}
+
+		c.processEvent(msg.Value)
+	}
+}
+
+func (c *CacheSync) processEvent(data []byte) {
+	var event cacheEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		log.Printf("Ошибка преобразования события кэша: %v", err)
+		return
+	}
+
+	// Свои же изменения уже применены локально
+	if event.Source == c.instanceID {
+		return
+	}
+
+	switch event.Op {
+	case cacheOpUpsert:
+		// Не расшифрованный заказ в кэш не кладем, локальная копия устарела
+		if err := c.cipher.open(&event); err != nil {
+			log.Printf("Ошибка события кэша, заказ вытесняется: %v", err)
+			c.service.ApplyOrderChange(event.OrderUID, nil)
+			return
+		}
+		c.service.ApplyOrderChange(event.OrderUID, event.Order)
+	case cacheOpEvict:
+		c.service.ApplyOrderChange(event.OrderUID, nil)
+	default:
+		log.Printf("Неизвестная операция события кэша: %q", event.Op)
+	}
+}
+
+func (c *CacheSync) Close() error {
+	return c.reader.Close()
+}
@@ -0,0 +1,61 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"order-service/internal/models"
+	"order-service/internal/pii"
+	"order-service/internal/repository"
+	"order-service/internal/repository/mocks"
+	"order-service/internal/service"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheSyncEncryption(t *testing.T) {
+	keyring, err := pii.NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, bytes.Repeat([]byte{9}, 32))
+	require.NoError(t, err)
+	cipher := newCacheCipher([]CacheSyncOption{WithCacheEncryption(keyring)})
+
+	order := testOrder("test-cache-pii")
+	event := cacheEvent{Op: cacheOpUpsert, OrderUID: order.OrderUID, Source: "other", Order: order}
+	require.NoError(t, cipher.seal(&event))
+	assert.Equal(t, "Test Testov", order.Delivery.Name, "исходный заказ не меняется")
+
+	payload, err := json.Marshal(event)
+	require.NoError(t, err)
+	for _, value := range []string{order.Delivery.Name, order.Delivery.Phone, order.Delivery.Address, order.Delivery.Email} {
+		assert.NotContains(t, string(payload), value)
+	}
+
+	newSync := func(opts ...CacheSyncOption) (*CacheSync, *repository.LRUCache) {
+		repo := mocks.NewMockOrderRepository(gomock.NewController(t))
+		repo.EXPECT().GetAllOrders(gomock.Any()).Return(map[string]*models.Order{}, nil)
+
+		cache := repository.NewCache(10)
+		svc := service.New(repo, cache)
+		return &CacheSync{service: svc, instanceID: "self", cipher: newCacheCipher(opts)}, cache
+	}
+
+	t.Run("peer with keyring caches decrypted order", func(t *testing.T) {
+		peer, cache := newSync(WithCacheEncryption(keyring))
+		peer.processEvent(payload)
+
+		cached, exists := cache.Get(order.OrderUID)
+		require.True(t, exists)
+		assert.Equal(t, order.Delivery, cached.Delivery)
+	})
+
+	t.Run("peer without keyring evicts order", func(t *testing.T) {
+		peer, cache := newSync()
+		cache.Set(order)
+		peer.processEvent(payload)
+
+		_, exists := cache.Get(order.OrderUID)
+		assert.False(t, exists)
+	})
+}
@@ -3,21 +3,65 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"sync"
 	"time"
 
+	"order-service/internal/audit"
 	"order-service/internal/models"
+	"order-service/internal/repository"
 	"order-service/internal/service"
 
 	"github.com/segmentio/kafka-go"
 )
 
+// Задержка повтора пачки, не сохраненной из-за недоступности бд,
+// растет вдвое с каждой попыткой до maxRetryBackoff
+const (
+	baseRetryBackoff = time.Second
+	maxRetryBackoff  = 30 * time.Second
+)
+
+// messageReader часть kafka.Reader, нужная консюмеру
+type messageReader interface {
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
 type Consumer struct {
-	reader  *kafka.Reader
+	reader  messageReader
 	service *service.Service
+
+	// Режим микро-пачек: batchSize > 1
+	batchSize    int
+	batchTimeout time.Duration
+
+	retryBackoff time.Duration
+	closed       chan struct{}
+
+	// Обработка последнего сообщения каждого заказа в обычном режиме:
+	// следующее сообщение того же заказа ждет ее завершения
+	mu       sync.Mutex
+	inflight map[string]chan struct{}
+}
+
+// Option настраивает консюмер
+type Option func(*Consumer)
+
+// WithBatching включает обработку сообщений пачками: пачка отправляется в бд,
+// когда набралось size сообщений или прошло timeout с первого сообщения пачки
+func WithBatching(size int, timeout time.Duration) Option {
+	return func(c *Consumer) {
+		c.batchSize = size
+		c.batchTimeout = timeout
+	}
 }
 
-func New(brokers []string, topic string, groupID string, svc *service.Service) *Consumer {
+func New(brokers []string, topic string, groupID string, svc *service.Service, opts ...Option) *Consumer {
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:        brokers,
 		Topic:          topic,
@@ -27,13 +71,27 @@ func New(brokers []string, topic string, groupID string, svc *service.Service) *
 		CommitInterval: time.Second,
 	})
 
-	return &Consumer{
-		reader:  reader,
-		service: svc,
+	c := &Consumer{
+		reader:       reader,
+		service:      svc,
+		retryBackoff: baseRetryBackoff,
+		closed:       make(chan struct{}),
+		inflight:     make(map[string]chan struct{}),
 	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
 }
 
 func (c *Consumer) Start() {
+	if c.batchSize > 1 {
+		c.startBatching()
+		return
+	}
+
 	log.Println("Запуск косюмера кафки...")
 
 	for {
@@ -43,18 +101,66 @@ func (c *Consumer) Start() {
 			continue
 		}
 
-		go c.processMessage(msg.Value)
+		c.dispatch(msg)
 	}
 }
 
-func (c *Consumer) processMessage(data []byte) {
-	var order models.Order
-	if err := json.Unmarshal(data, &order); err != nil {
+// dispatch обрабатывает сообщения разных заказов параллельно, а сообщения
+// одного заказа - по очереди: обновление не обгоняет вставку заказа и
+// предыдущие обновления
+func (c *Consumer) dispatch(m kafka.Message) {
+	var msg orderMessage
+	if err := json.Unmarshal(m.Value, &msg); err != nil {
 		log.Printf("Ошибка преобразования сообщения: %v", err)
 		return
 	}
 
-	if err := c.service.ProcessOrder(&order); err != nil {
+	orderUID := msg.OrderUID
+	done := make(chan struct{})
+	c.mu.Lock()
+	prev := c.inflight[orderUID]
+	c.inflight[orderUID] = done
+	c.mu.Unlock()
+
+	go func() {
+		if prev != nil {
+			<-prev
+		}
+		c.processMessage(m, &msg)
+
+		c.mu.Lock()
+		if c.inflight[orderUID] == done {
+			delete(c.inflight, orderUID)
+		}
+		c.mu.Unlock()
+		close(done)
+	}()
+}
+
+// orderMessage сообщение топика заказов. Если задан expected_version,
+// это обновление существующего заказа, иначе - новый заказ.
+type orderMessage struct {
+	models.Order
+	ExpectedVersion *int64 `json:"expected_version,omitempty"`
+}
+
+// auditSource источник изменений для журнала: сообщение топика заказов
+func auditSource(m kafka.Message) audit.Source {
+	return audit.Source{
+		Type:  audit.SourceKafka,
+		Kafka: &audit.KafkaPosition{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset},
+	}
+}
+
+func (c *Consumer) processMessage(m kafka.Message, msg *orderMessage) {
+	ctx := audit.WithSource(context.Background(), auditSource(m))
+	if msg.ExpectedVersion != nil {
+		c.processUpdate(ctx, msg)
+		return
+	}
+
+	order := msg.Order
+	if err := c.service.ProcessOrder(ctx, &order); err != nil {
 		log.Printf("Ошибка обработки заказа %s: %v", order.OrderUID, err)
 		return
 	}
@@ -62,6 +168,160 @@ func (c *Consumer) processMessage(data []byte) {
 	log.Printf("Успешная обработка заказа: %s", order.OrderUID)
 }
 
+func (c *Consumer) processUpdate(ctx context.Context, msg *orderMessage) error {
+	order := msg.Order
+	if err := c.service.UpdateOrder(ctx, &order, *msg.ExpectedVersion); err != nil {
+		log.Printf("Ошибка обновления заказа %s (ожидалась версия %d): %v", order.OrderUID, *msg.ExpectedVersion, err)
+		return err
+	}
+
+	log.Printf("Успешное обновление заказа %s до версии %d", order.OrderUID, order.Version)
+	return nil
+}
+
+// retryable сообщает, что сообщение не обработано из-за недоступности бд
+// и его нужно повторить. Ошибки самого заказа повторно не обрабатываются.
+func retryable(err error) bool {
+	return err != nil && !errors.Is(err, service.ErrInvalidOrder) && repository.IsTransient(err)
+}
+
+// startBatching читает сообщения пачками и коммитит offset после сохранения пачки
+func (c *Consumer) startBatching() {
+	log.Printf("Запуск косюмера кафки в режиме пачек: до %d сообщений, ожидание %s...", c.batchSize, c.batchTimeout)
+
+	for {
+		batch, err := c.fetchBatch()
+		if len(batch) > 0 {
+			c.processBatch(batch)
+		}
+		if errors.Is(err, io.EOF) {
+			return // ридер закрыт
+		}
+	}
+}
+
+// fetchBatch набирает пачку сообщений: первое ждем без ограничений,
+// остальные - не дольше batchTimeout
+func (c *Consumer) fetchBatch() ([]kafka.Message, error) {
+	first, err := c.reader.FetchMessage(context.Background())
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			log.Printf("Ошибка чтения сообщения: %v", err)
+		}
+		return nil, err
+	}
+
+	batch := []kafka.Message{first}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.batchTimeout)
+	defer cancel()
+
+	for len(batch) < c.batchSize {
+		msg, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return batch, nil
+			}
+			return batch, err
+		}
+		batch = append(batch, msg)
+	}
+
+	return batch, nil
+}
+
+// processBatch обрабатывает пачку и коммитит ее offset. Сообщения, не
+// обработанные из-за недоступности бд, повторяются с растущей задержкой;
+// пока они не обработаны, offset не коммитится. Если консюмер закрыли во время
+// ожидания, пачка не коммитится и после перезапуска будет прочитана снова.
+// Ошибочные заказы повторно не обрабатываем, как и в обычном режиме.
+func (c *Consumer) processBatch(messages []kafka.Message) {
+	pending := messages
+	for attempt := 1; ; attempt++ {
+		pending = c.handleBatch(pending)
+		if len(pending) == 0 {
+			break
+		}
+
+		delay := c.backoff(attempt)
+		log.Printf("Бд недоступна: %d сообщений пачки будут повторены через %s", len(pending), delay)
+		select {
+		case <-c.closed:
+			return
+		case <-time.After(delay):
+		}
+	}
+
+	if err := c.reader.CommitMessages(context.Background(), messages...); err != nil {
+		log.Printf("Ошибка коммита пачки сообщений: %v", err)
+	}
+}
+
+// handleBatch сохраняет заказы пачки одной транзакцией, затем применяет обновления.
+// Возвращает сообщения, которые нужно повторить.
+func (c *Consumer) handleBatch(messages []kafka.Message) []kafka.Message {
+	orders := make([]*models.Order, 0, len(messages))
+	orderMessages := make([]kafka.Message, 0, len(messages))
+	sources := make(map[string]audit.Source, len(messages))
+	var updateMessages []kafka.Message
+	var updateBodies []orderMessage
+	for _, m := range messages {
+		var msg orderMessage
+		if err := json.Unmarshal(m.Value, &msg); err != nil {
+			log.Printf("Ошибка преобразования сообщения (offset %d): %v", m.Offset, err)
+			continue
+		}
+
+		if msg.ExpectedVersion != nil {
+			updateMessages = append(updateMessages, m)
+			updateBodies = append(updateBodies, msg)
+			continue
+		}
+		orders = append(orders, &msg.Order)
+		orderMessages = append(orderMessages, m)
+		sources[msg.OrderUID] = auditSource(m)
+	}
+
+	var retry []kafka.Message
+	if len(orders) > 0 {
+		ctx := audit.WithOrderSources(context.Background(), sources)
+		for i, err := range c.service.ProcessOrders(ctx, orders) {
+			if err == nil {
+				continue
+			}
+			log.Printf("Ошибка обработки заказа %s: %v", orders[i].OrderUID, err)
+			if retryable(err) {
+				retry = append(retry, orderMessages[i])
+			}
+		}
+	}
+
+	// Обновления идут по одному после вставок: у каждого своя проверка версии,
+	// и они могут относиться к заказам из этой же пачки. Если вставки придется
+	// повторять, обновления откладываются вместе с ними.
+	if len(retry) > 0 {
+		return append(retry, updateMessages...)
+	}
+	for i, m := range updateMessages {
+		ctx := audit.WithSource(context.Background(), auditSource(m))
+		if err := c.processUpdate(ctx, &updateBodies[i]); retryable(err) {
+			// Следующие обновления могут зависеть от этого
+			return updateMessages[i:]
+		}
+	}
+
+	return nil
+}
+
+func (c *Consumer) backoff(attempt int) time.Duration {
+	delay := c.retryBackoff
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryBackoff)
+}
+
 func (c *Consumer) Close() error {
+	close(c.closed)
 	return c.reader.Close()
 }
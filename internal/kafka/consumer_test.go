@@ -0,0 +1,240 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"order-service/internal/models"
+	"order-service/internal/repository"
+	"order-service/internal/repository/mocks"
+	"order-service/internal/service"
+
+	"github.com/golang/mock/gomock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeReader отдает сообщения из канала и запоминает коммиты
+type fakeReader struct {
+	messages chan kafka.Message
+
+	mu        sync.Mutex
+	committed []int64
+}
+
+func newFakeReader(messages ...kafka.Message) *fakeReader {
+	r := &fakeReader{messages: make(chan kafka.Message, len(messages))}
+	for _, m := range messages {
+		r.messages <- m
+	}
+	return r
+}
+
+func (r *fakeReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	return r.FetchMessage(ctx)
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case m := <-r.messages:
+		return m, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range msgs {
+		r.committed = append(r.committed, m.Offset)
+	}
+	return nil
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+func (r *fakeReader) Committed() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.committed
+}
+
+func testOrder(orderUID string) *models.Order {
+	return &models.Order{
+		OrderUID: orderUID, TrackNumber: "WBILMTESTTRACK", Entry: "WBIL", Locale: "en",
+		CustomerID: "test", DeliveryService: "meest", Shardkey: "9", SmID: 99,
+		DateCreated: time.Now(), OofShard: "1",
+		Delivery: models.Delivery{
+			Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction: orderUID, Currency: "USD", Provider: "wbpay", Amount: 1817,
+			PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317,
+		},
+		Items: []models.Item{{
+			ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, Rid: "ab4219087a764ae0btest",
+			Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: 317, NmID: 2389212,
+			Brand: "Vivienne Sabo", Status: 202,
+		}},
+	}
+}
+
+func message(t *testing.T, offset int64, msg orderMessage) kafka.Message {
+	value, err := json.Marshal(msg)
+	require.NoError(t, err)
+	return kafka.Message{Topic: "orders", Offset: offset, Value: value}
+}
+
+func newTestConsumer(t *testing.T, reader messageReader) (*Consumer, *mocks.MockOrderRepository) {
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockOrderRepository(ctrl)
+	repo.EXPECT().GetAllOrders(gomock.Any()).Return(map[string]*models.Order{}, nil)
+
+	svc := service.New(repo, repository.NewCache(10))
+	return &Consumer{
+		reader:       reader,
+		service:      svc,
+		batchSize:    2,
+		batchTimeout: 20 * time.Millisecond,
+		retryBackoff: time.Millisecond,
+		closed:       make(chan struct{}),
+		inflight:     make(map[string]chan struct{}),
+	}, repo
+}
+
+func TestFetchBatch(t *testing.T) {
+	reader := newFakeReader(
+		kafka.Message{Offset: 1}, kafka.Message{Offset: 2}, kafka.Message{Offset: 3},
+	)
+	c, _ := newTestConsumer(t, reader)
+
+	batch, err := c.fetchBatch()
+	require.NoError(t, err)
+	assert.Len(t, batch, 2, "пачка ограничена batchSize")
+
+	// Третье сообщение ждет остальных не дольше batchTimeout
+	batch, err = c.fetchBatch()
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+	assert.Equal(t, int64(3), batch[0].Offset)
+}
+
+func TestProcessBatch(t *testing.T) {
+	dbDown := &pgconn.PgError{Code: "57P01", Message: "terminating connection due to administrator command"}
+	duplicate := &pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"}
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+	t.Run("commits after per-order errors", func(t *testing.T) {
+		invalid := testOrder("invalid")
+		invalid.Payment.GoodsTotal = 1
+		messages := []kafka.Message{
+			message(t, 1, orderMessage{Order: *testOrder("dup")}),
+			message(t, 2, orderMessage{Order: *invalid}),
+			{Offset: 3, Value: []byte("not json")},
+		}
+		reader := newFakeReader()
+		c, repo := newTestConsumer(t, reader)
+
+		repo.EXPECT().SaveOrders(gomock.Any(), gomock.Len(1)).Return([]error{duplicate}, nil)
+
+		c.processBatch(messages)
+		assert.Equal(t, []int64{1, 2, 3}, reader.Committed())
+	})
+
+	t.Run("retries batch while database is unavailable", func(t *testing.T) {
+		version := int64(1)
+		messages := []kafka.Message{
+			message(t, 1, orderMessage{Order: *testOrder("order1")}),
+			message(t, 2, orderMessage{Order: *testOrder("order1"), ExpectedVersion: &version}),
+		}
+		reader := newFakeReader()
+		c, repo := newTestConsumer(t, reader)
+
+		// Обновление применяется только после успешной вставки
+		gomock.InOrder(
+			repo.EXPECT().SaveOrders(gomock.Any(), gomock.Len(1)).Return(nil, refused),
+			repo.EXPECT().SaveOrders(gomock.Any(), gomock.Len(1)).Return([]error{dbDown}, nil),
+			repo.EXPECT().SaveOrders(gomock.Any(), gomock.Len(1)).Return([]error{nil}, nil),
+			repo.EXPECT().UpdateOrder(gomock.Any(), gomock.Any(), int64(1)).Return(dbDown),
+			repo.EXPECT().UpdateOrder(gomock.Any(), gomock.Any(), int64(1)).Return(nil),
+		)
+
+		c.processBatch(messages)
+		assert.Equal(t, []int64{1, 2}, reader.Committed())
+	})
+
+	t.Run("does not commit when closed during retry", func(t *testing.T) {
+		reader := newFakeReader()
+		c, repo := newTestConsumer(t, reader)
+		c.retryBackoff = time.Hour
+
+		repo.EXPECT().SaveOrders(gomock.Any(), gomock.Len(1)).Return(nil, refused)
+
+		done := make(chan struct{})
+		go func() {
+			c.processBatch([]kafka.Message{message(t, 1, orderMessage{Order: *testOrder("order1")})})
+			close(done)
+		}()
+
+		require.NoError(t, c.Close())
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("processBatch не завершился после Close")
+		}
+		assert.Empty(t, reader.Committed())
+	})
+}
+
+func TestDispatch(t *testing.T) {
+	c, repo := newTestConsumer(t, newFakeReader())
+	version := int64(1)
+
+	release := make(chan struct{})
+	updated := make(chan struct{})
+	gomock.InOrder(
+		repo.EXPECT().SaveOrder(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(context.Context, *models.Order) error {
+				<-release
+				return nil
+			}),
+		repo.EXPECT().UpdateOrder(gomock.Any(), gomock.Any(), int64(1)).
+			DoAndReturn(func(context.Context, *models.Order, int64) error {
+				close(updated)
+				return nil
+			}),
+	)
+
+	// Обновление пришло, пока заказ еще сохраняется
+	c.dispatch(message(t, 1, orderMessage{Order: *testOrder("order1")}))
+	c.dispatch(message(t, 2, orderMessage{Order: *testOrder("order1"), ExpectedVersion: &version}))
+
+	select {
+	case <-updated:
+		t.Fatal("обновление обогнало вставку заказа")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-updated:
+	case <-time.After(time.Second):
+		t.Fatal("обновление не применено после вставки")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c := &Consumer{retryBackoff: time.Second}
+	assert.Equal(t, time.Second, c.backoff(1))
+	assert.Equal(t, 4*time.Second, c.backoff(3))
+	assert.Equal(t, maxRetryBackoff, c.backoff(100))
+}
@@ -0,0 +1,147 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"order-service/internal/repository"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	defaultRelayInterval  = time.Second
+	defaultRelayBatchSize = 100
+	// Как часто удалять отправленные события
+	outboxPurgeInterval = time.Hour
+)
+
+// OutboxStore бд, из outbox которой ретранслируются события
+type OutboxStore interface {
+	RelayOutbox(ctx context.Context, limit int,
+		publish func(ctx context.Context, messages []repository.OutboxMessage) []error) (int, error)
+	PurgeOutbox(ctx context.Context, before time.Time) (int64, error)
+}
+
+// OutboxRelay публикует события из outbox одной бд в топик.
+// Доставка at-least-once: сбой после отправки, но до отметки в бд,
+// приведет к повторной публикации, поэтому получатели должны быть идемпотентны.
+type OutboxRelay struct {
+	store     OutboxStore
+	writer    *kafka.Writer
+	interval  time.Duration
+	batchSize int
+	retention time.Duration
+}
+
+type RelayOption func(r *OutboxRelay)
+
+// WithRelayPolling задает период опроса outbox и размер пачки
+func WithRelayPolling(interval time.Duration, batchSize int) RelayOption {
+	return func(r *OutboxRelay) {
+		if interval > 0 {
+			r.interval = interval
+		}
+		if batchSize > 0 {
+			r.batchSize = batchSize
+		}
+	}
+}
+
+// WithRelayRetention задает, сколько хранить отправленные события (0 - всегда)
+func WithRelayRetention(retention time.Duration) RelayOption {
+	return func(r *OutboxRelay) {
+		r.retention = retention
+	}
+}
+
+func NewOutboxRelay(brokers []string, topic string, store OutboxStore, opts ...RelayOption) *OutboxRelay {
+	r := &OutboxRelay{
+		store: store,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: 10 * time.Millisecond,
+		},
+		interval:  defaultRelayInterval,
+		batchSize: defaultRelayBatchSize,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Run ретранслирует события до отмены ctx. Полная пачка забирается
+// следующей сразу, иначе relay ждет interval.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	lastPurge := time.Time{}
+	for {
+		sent, err := r.store.RelayOutbox(ctx, r.batchSize, r.publish)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Ошибка ретрансляции outbox: %v", err)
+		}
+
+		if r.retention > 0 && time.Since(lastPurge) > outboxPurgeInterval {
+			lastPurge = time.Now()
+			if _, err := r.store.PurgeOutbox(ctx, lastPurge.Add(-r.retention)); err != nil && ctx.Err() == nil {
+				log.Printf("Ошибка очистки outbox: %v", err)
+			}
+		}
+
+		if err == nil && sent == r.batchSize {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish отправляет пачку и раскладывает ошибку по сообщениям
+func (r *OutboxRelay) publish(ctx context.Context, messages []repository.OutboxMessage) []error {
+	kafkaMessages := make([]kafka.Message, len(messages))
+	for i, m := range messages {
+		kafkaMessages[i] = kafka.Message{
+			Key:     []byte(m.OrderUID),
+			Value:   m.Payload,
+			Headers: []kafka.Header{{Key: "event_type", Value: []byte(m.EventType)}},
+		}
+	}
+
+	errs := make([]error, len(messages))
+	err := r.writer.WriteMessages(ctx, kafkaMessages...)
+	if err == nil {
+		return errs
+	}
+
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) && len(writeErrs) == len(messages) {
+		copy(errs, writeErrs)
+		return errs
+	}
+
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+func (r *OutboxRelay) Close() error {
+	return r.writer.Close()
+}
@@ -0,0 +1,145 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Внешние ключи на секционированную таблицу должны включать ключ секционирования,
+-- поэтому ссылки deliveries/payments/items на orders(order_uid) убираются.
+-- Уникальность order_uid по-прежнему обеспечивают первичные ключи deliveries и payments.
+ALTER TABLE deliveries DROP CONSTRAINT IF EXISTS deliveries_order_uid_fkey;
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_order_uid_fkey;
+ALTER TABLE items DROP CONSTRAINT IF EXISTS items_order_uid_fkey;
+
+ALTER TABLE orders RENAME TO orders_legacy;
+ALTER TABLE items RENAME TO items_legacy;
+
+CREATE TABLE orders (
+    order_uid TEXT NOT NULL,
+    track_number TEXT NOT NULL,
+    entry TEXT NOT NULL,
+    locale VARCHAR(2) NOT NULL,
+    internal_signature TEXT NOT NULL,
+    customer_id TEXT NOT NULL,
+    delivery_service TEXT NOT NULL,
+    shardkey TEXT NOT NULL,
+    sm_id INTEGER NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    oof_shard TEXT NOT NULL,
+    version BIGINT NOT NULL DEFAULT 1,
+    PRIMARY KEY (order_uid, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE TABLE items (
+    order_uid TEXT NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    chrt_id INTEGER NOT NULL,
+    track_number TEXT NOT NULL,
+    price INTEGER NOT NULL,
+    rid TEXT NOT NULL,
+    name TEXT NOT NULL,
+    sale INTEGER NOT NULL,
+    size TEXT NOT NULL,
+    total_price INTEGER NOT NULL,
+    nm_id INTEGER NOT NULL,
+    brand TEXT NOT NULL,
+    status INTEGER NOT NULL
+) PARTITION BY RANGE (date_created);
+
+CREATE INDEX orders_order_uid_idx ON orders (order_uid);
+CREATE INDEX items_order_uid_idx ON items (order_uid, date_created);
+
+-- Заказы вне созданных месячных секций попадают в default
+CREATE TABLE orders_default PARTITION OF orders DEFAULT;
+CREATE TABLE items_default PARTITION OF items DEFAULT;
+
+-- Месячные секции orders_pYYYYMM / items_pYYYYMM от самого старого заказа до +3 месяцев
+DO $$
+DECLARE
+    month_start TIMESTAMPTZ;
+    last_month TIMESTAMPTZ := date_trunc('month', now() AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' + INTERVAL '3 months';
+BEGIN
+    SELECT COALESCE(date_trunc('month', min(date_created) AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+                    date_trunc('month', now() AT TIME ZONE 'UTC') AT TIME ZONE 'UTC')
+    INTO month_start
+    FROM orders_legacy;
+
+    WHILE month_start <= last_month LOOP
+        EXECUTE format('CREATE TABLE %I PARTITION OF orders FOR VALUES FROM (%L) TO (%L)',
+            'orders_p' || to_char(month_start AT TIME ZONE 'UTC', 'YYYYMM'),
+            month_start, month_start + INTERVAL '1 month');
+        EXECUTE format('CREATE TABLE %I PARTITION OF items FOR VALUES FROM (%L) TO (%L)',
+            'items_p' || to_char(month_start AT TIME ZONE 'UTC', 'YYYYMM'),
+            month_start, month_start + INTERVAL '1 month');
+        month_start := month_start + INTERVAL '1 month';
+    END LOOP;
+END
+$$;
+
+INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id,
+    delivery_service, shardkey, sm_id, date_created, oof_shard, version)
+SELECT order_uid, track_number, entry, locale, internal_signature, customer_id,
+    delivery_service, shardkey, sm_id, date_created, oof_shard, version
+FROM orders_legacy;
+
+INSERT INTO items (order_uid, date_created, chrt_id, track_number, price, rid, name, sale, size,
+    total_price, nm_id, brand, status)
+SELECT i.order_uid, o.date_created, i.chrt_id, i.track_number, i.price, i.rid, i.name, i.sale, i.size,
+    i.total_price, i.nm_id, i.brand, i.status
+FROM items_legacy i
+JOIN orders_legacy o ON o.order_uid = i.order_uid;
+
+DROP TABLE items_legacy;
+DROP TABLE orders_legacy;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE orders RENAME TO orders_partitioned;
+ALTER TABLE items RENAME TO items_partitioned;
+
+CREATE TABLE orders (
+    order_uid TEXT PRIMARY KEY NOT NULL,
+    track_number TEXT NOT NULL,
+    entry TEXT NOT NULL,
+    locale VARCHAR(2) NOT NULL,
+    internal_signature TEXT NOT NULL,
+    customer_id TEXT NOT NULL,
+    delivery_service TEXT NOT NULL,
+    shardkey TEXT NOT NULL,
+    sm_id INTEGER NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    oof_shard TEXT NOT NULL,
+    version BIGINT NOT NULL DEFAULT 1
+);
+
+CREATE TABLE items (
+    order_uid TEXT NOT NULL REFERENCES orders (order_uid),
+    chrt_id INTEGER NOT NULL,
+    track_number TEXT NOT NULL,
+    price INTEGER NOT NULL,
+    rid TEXT NOT NULL,
+    name TEXT NOT NULL,
+    sale INTEGER NOT NULL,
+    size TEXT NOT NULL,
+    total_price INTEGER NOT NULL,
+    nm_id INTEGER NOT NULL,
+    brand TEXT NOT NULL,
+    status INTEGER NOT NULL
+);
+
+INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id,
+    delivery_service, shardkey, sm_id, date_created, oof_shard, version)
+SELECT order_uid, track_number, entry, locale, internal_signature, customer_id,
+    delivery_service, shardkey, sm_id, date_created, oof_shard, version
+FROM orders_partitioned;
+
+INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name, sale, size,
+    total_price, nm_id, brand, status)
+SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size,
+    total_price, nm_id, brand, status
+FROM items_partitioned;
+
+DROP TABLE items_partitioned;
+DROP TABLE orders_partitioned;
+
+ALTER TABLE deliveries ADD CONSTRAINT deliveries_order_uid_fkey FOREIGN KEY (order_uid) REFERENCES orders (order_uid);
+ALTER TABLE payments ADD CONSTRAINT payments_order_uid_fkey FOREIGN KEY (order_uid) REFERENCES orders (order_uid);
+
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS order_audit (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR(255) NOT NULL,
+    operation VARCHAR(16) NOT NULL,
+    source JSONB NOT NULL,
+    changes JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_audit_order_uid ON order_audit (order_uid, id);
+
+-- Журнал только дополняется
+CREATE OR REPLACE FUNCTION order_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'order_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER order_audit_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON order_audit
+    FOR EACH STATEMENT EXECUTE FUNCTION order_audit_append_only();
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS order_audit;
+DROP FUNCTION IF EXISTS order_audit_append_only();
+
+-- +goose StatementEnd
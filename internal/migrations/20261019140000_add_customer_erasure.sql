@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS erased_at TIMESTAMPTZ;
+
+-- Журнал по-прежнему только дополняется, но при удалении персональных данных
+-- транзакция может вычистить их из старых записей, выставив order_audit.redact
+CREATE OR REPLACE FUNCTION order_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND current_setting('order_audit.redact', true) = 'on' THEN
+        RETURN NULL;
+    END IF;
+    RAISE EXCEPTION 'order_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION order_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'order_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS erased_at;
+
+-- +goose StatementEnd
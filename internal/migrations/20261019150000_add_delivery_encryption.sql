@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- key_id и wrapped_key заданы у строк с зашифрованными name, phone, address и email;
+-- у строк без них эти поля хранятся открыто
+ALTER TABLE deliveries
+    ADD COLUMN IF NOT EXISTS key_id TEXT,
+    ADD COLUMN IF NOT EXISTS wrapped_key TEXT,
+    ADD COLUMN IF NOT EXISTS email_hash TEXT,
+    ADD COLUMN IF NOT EXISTS phone_hash TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_deliveries_email_hash ON deliveries (email_hash);
+CREATE INDEX IF NOT EXISTS idx_deliveries_phone_hash ON deliveries (phone_hash);
+CREATE INDEX IF NOT EXISTS idx_deliveries_key_id ON deliveries (key_id);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE deliveries
+    DROP COLUMN IF EXISTS key_id,
+    DROP COLUMN IF EXISTS wrapped_key,
+    DROP COLUMN IF EXISTS email_hash,
+    DROP COLUMN IF EXISTS phone_hash;
+
+-- +goose StatementEnd
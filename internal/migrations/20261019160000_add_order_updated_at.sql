@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ;
+
+-- Существующие заказы считаются неизменными с момента создания
+UPDATE orders SET updated_at = date_created WHERE updated_at IS NULL;
+
+ALTER TABLE orders
+    ALTER COLUMN updated_at SET DEFAULT now(),
+    ALTER COLUMN updated_at SET NOT NULL;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS updated_at;
+
+-- +goose StatementEnd
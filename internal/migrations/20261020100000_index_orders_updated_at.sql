@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Сверка снапшота кэша догружает заказы, измененные после него
+CREATE INDEX IF NOT EXISTS idx_orders_updated_at ON orders (updated_at);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_orders_updated_at;
+
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Первичный ключ секционированной orders включает date_created и не мешает
+-- повторить order_uid в другой секции. order_keys хранит один date_created на
+-- order_uid: она обеспечивает уникальность и позволяет точечным запросам
+-- обращаться только к секции заказа.
+CREATE TABLE IF NOT EXISTS order_keys (
+    order_uid TEXT PRIMARY KEY,
+    date_created TIMESTAMPTZ NOT NULL
+);
+
+INSERT INTO order_keys (order_uid, date_created)
+SELECT order_uid, date_created FROM orders
+ON CONFLICT (order_uid) DO NOTHING;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS order_keys;
+
+-- +goose StatementEnd
@@ -0,0 +1,104 @@
+-- +goose Up
+-- +goose StatementBegin
+-- order_audit.redact мог выставить любой сеанс и после этого менять журнал
+-- как угодно. Теперь журнал по-прежнему нельзя удалять, а UPDATE пропускает
+-- построчный триггер, только если меняются лишь персональные данные: их ключи
+-- убираются или значения заменяются на null, "[encrypted]" или "[erased]".
+-- Приложение вычищает журнал через функции order_audit_erase и order_audit_mask
+-- (SECURITY DEFINER): роли приложения достаточно прав на INSERT и SELECT.
+CREATE OR REPLACE FUNCTION order_audit_pii_fields() RETURNS TEXT[] AS $$
+    SELECT ARRAY['customer_id', 'internal_signature',
+                 'delivery.name', 'delivery.phone', 'delivery.address', 'delivery.email']
+$$ LANGUAGE sql IMMUTABLE;
+
+DROP TRIGGER IF EXISTS order_audit_append_only ON order_audit;
+
+CREATE OR REPLACE FUNCTION order_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'order_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER order_audit_append_only
+    BEFORE DELETE OR TRUNCATE ON order_audit
+    FOR EACH STATEMENT EXECUTE FUNCTION order_audit_append_only();
+
+CREATE OR REPLACE FUNCTION order_audit_redact_only() RETURNS trigger AS $$
+DECLARE
+    pii CONSTANT TEXT[] := order_audit_pii_fields();
+    field TEXT;
+    change_side TEXT;
+    change_value JSONB;
+BEGIN
+    IF NEW.id IS DISTINCT FROM OLD.id
+        OR NEW.order_uid IS DISTINCT FROM OLD.order_uid
+        OR NEW.operation IS DISTINCT FROM OLD.operation
+        OR NEW.source IS DISTINCT FROM OLD.source
+        OR NEW.created_at IS DISTINCT FROM OLD.created_at
+        OR (NEW.changes - pii) IS DISTINCT FROM (OLD.changes - pii) THEN
+        RAISE EXCEPTION 'order_audit is append-only: only personal data can be redacted';
+    END IF;
+
+    FOREACH field IN ARRAY pii LOOP
+        CONTINUE WHEN NEW.changes IS NULL OR NOT NEW.changes ? field;
+        FOR change_side, change_value IN SELECT e.key, e.value FROM jsonb_each(NEW.changes -> field) e LOOP
+            IF change_value IS DISTINCT FROM OLD.changes -> field -> change_side
+                AND change_value NOT IN ('null'::jsonb, '"[encrypted]"'::jsonb, '"[erased]"'::jsonb) THEN
+                RAISE EXCEPTION 'order_audit is append-only: % can only be redacted', field;
+            END IF;
+        END LOOP;
+    END LOOP;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER order_audit_redact_only
+    BEFORE UPDATE ON order_audit
+    FOR EACH ROW EXECUTE FUNCTION order_audit_redact_only();
+
+-- Убирает персональные данные из журнала заказов, возвращает число измененных записей
+CREATE OR REPLACE FUNCTION order_audit_erase(order_uids TEXT[]) RETURNS BIGINT
+    LANGUAGE sql SECURITY DEFINER SET search_path FROM CURRENT AS $$
+    WITH erased AS (
+        UPDATE order_audit SET changes = changes - order_audit_pii_fields()
+        WHERE order_uid = ANY(order_uids) AND changes ?| order_audit_pii_fields()
+        RETURNING 1
+    )
+    SELECT count(*) FROM erased
+$$;
+
+-- Заменяет изменения записи журнала замаскированными; триггер проверяет,
+-- что замаскированы только персональные данные
+CREATE OR REPLACE FUNCTION order_audit_mask(audit_id BIGINT, masked JSONB) RETURNS VOID
+    LANGUAGE sql SECURITY DEFINER SET search_path FROM CURRENT AS $$
+    UPDATE order_audit SET changes = masked WHERE id = audit_id
+$$;
+
+REVOKE UPDATE, DELETE, TRUNCATE ON order_audit FROM PUBLIC;
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION IF EXISTS order_audit_mask(BIGINT, JSONB);
+DROP FUNCTION IF EXISTS order_audit_erase(TEXT[]);
+DROP TRIGGER IF EXISTS order_audit_redact_only ON order_audit;
+DROP FUNCTION IF EXISTS order_audit_redact_only();
+DROP TRIGGER IF EXISTS order_audit_append_only ON order_audit;
+
+CREATE OR REPLACE FUNCTION order_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND current_setting('order_audit.redact', true) = 'on' THEN
+        RETURN NULL;
+    END IF;
+    RAISE EXCEPTION 'order_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER order_audit_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON order_audit
+    FOR EACH STATEMENT EXECUTE FUNCTION order_audit_append_only();
+
+DROP FUNCTION IF EXISTS order_audit_pii_fields();
+
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Обезличенные покупатели: заказы из архива восстанавливаются для них обезличенными.
+-- customer_id хранится в виде sha256.
+CREATE TABLE IF NOT EXISTS erased_customers (
+    customer_hash TEXT PRIMARY KEY,
+    erased_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS erased_customers;
+
+-- +goose StatementEnd
@@ -0,0 +1,102 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io"
+	"log"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+// Migrator применяет встроенные в бинарник миграции goose.
+// Все операции берут advisory lock в postgres, поэтому реплики,
+// стартующие одновременно, не накатывают миграции параллельно.
+type Migrator struct {
+	db       *sql.DB
+	provider *goose.Provider
+}
+
+func NewMigrator(databaseURL string) (*Migrator, error) {
+	db, err := sql.Open("pgx", databaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ждем lock до 5 минут: 60 попыток раз в 5 секунд
+	locker, err := lock.NewPostgresSessionLocker(lock.WithLockTimeout(5, 60))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, FS, goose.WithSessionLocker(locker))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Migrator{db: db, provider: provider}, nil
+}
+
+func (m *Migrator) Close() error {
+	return m.provider.Close()
+}
+
+// Up применяет все непримененные миграции
+func (m *Migrator) Up(ctx context.Context) error {
+	results, err := m.provider.Up(ctx)
+	logResults(results...)
+	return err
+}
+
+// Down откатывает последнюю примененную миграцию
+func (m *Migrator) Down(ctx context.Context) error {
+	result, err := m.provider.Down(ctx)
+	logResults(result)
+	return err
+}
+
+// Redo откатывает и заново применяет последнюю миграцию
+func (m *Migrator) Redo(ctx context.Context) error {
+	if err := m.Down(ctx); err != nil {
+		return err
+	}
+
+	result, err := m.provider.UpByOne(ctx)
+	logResults(result)
+	return err
+}
+
+// Status печатает состояние всех миграций
+func (m *Migrator) Status(ctx context.Context, w io.Writer) error {
+	statuses, err := m.provider.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, st := range statuses {
+		appliedAt := "Pending"
+		if !st.AppliedAt.IsZero() {
+			appliedAt = st.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%-20s %s\n", appliedAt, st.Source.Path)
+	}
+
+	return nil
+}
+
+func logResults(results ...*goose.MigrationResult) {
+	for _, result := range results {
+		if result != nil {
+			log.Printf("Миграция: %s", result)
+		}
+	}
+}
@@ -17,6 +17,8 @@ type Order struct {
 	SmID              int       `json:"sm_id" db:"sm_id" validate:"required,min=1"`
 	DateCreated       time.Time `json:"date_created" db:"date_created" validate:"required"`
 	OofShard          string    `json:"oof_shard" db:"oof_shard" validate:"required,min=1"`
+	Version           int64     `json:"version,omitempty" db:"version"`      // оптимистичная блокировка, задается бд
+	UpdatedAt         time.Time `json:"updated_at,omitzero" db:"updated_at"` // время последнего изменения, задается при записи
 }
 
 type Delivery struct {
@@ -58,3 +60,18 @@ type Item struct {
 	Brand       string `json:"brand" db:"brand" validate:"required,min=1"`
 	Status      int    `json:"status" db:"status" validate:"required,min=0"`
 }
+
+// Clone возвращает глубокую копию заказа, не разделяющую память с исходным
+func (o *Order) Clone() *Order {
+	if o == nil {
+		return nil
+	}
+
+	clone := *o
+	if o.Items != nil {
+		clone.Items = make([]Item, len(o.Items))
+		copy(clone.Items, o.Items)
+	}
+
+	return &clone
+}
@@ -0,0 +1,16 @@
+// Package openapi содержит описание HTTP API сервиса в формате OpenAPI 3
+// и страницу для его просмотра. Соответствие описания и обработчиков
+// проверяется тестами cmd/server.
+package openapi
+
+import _ "embed"
+
+// Spec описание API (openapi.json)
+//
+//go:embed openapi.json
+var Spec []byte
+
+// Viewer страница просмотра описания, загружает его с /openapi.json
+//
+//go:embed viewer.html
+var Viewer []byte
@@ -0,0 +1,41 @@
+package pii
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+)
+
+// EmailIndex blind index email: HMAC-SHA256 от адреса без пробелов
+// по краям и в нижнем регистре. Пустой адрес не индексируется.
+func (k *Keyring) EmailIndex(email string) string {
+	return k.blindIndex("email", strings.ToLower(strings.TrimSpace(email)))
+}
+
+// PhoneIndex blind index телефона: HMAC-SHA256 от его цифр,
+// поэтому "+972 000-00-00" и "+9720000000" совпадают.
+func (k *Keyring) PhoneIndex(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+	return k.blindIndex("phone", digits)
+}
+
+// blindIndex разделяет поля префиксом, чтобы одинаковые значения
+// разных полей давали разные хэши
+func (k *Keyring) blindIndex(field, value string) string {
+	if value == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,138 @@
+package pii
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+var ErrDecrypt = errors.New("не удалось расшифровать данные")
+
+// Envelope ключ данных строки, зашифрованный мастер-ключом KeyID
+type Envelope struct {
+	KeyID      string `json:"key_id"`
+	WrappedKey string `json:"wrapped_key"`
+}
+
+// Seal шифрует values новым ключом данных (AES-256-GCM). Ключ данных
+// шифруется мастер-ключом primary. aad привязывает шифротекст к строке:
+// расшифровать его с другим aad нельзя.
+func (k *Keyring) Seal(aad string, values ...string) (Envelope, []string, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return Envelope{}, nil, err
+	}
+
+	wrapped, err := k.wrap(k.primary, dataKey)
+	if err != nil {
+		return Envelope{}, nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return Envelope{}, nil, err
+	}
+	sealed := make([]string, len(values))
+	for i, value := range values {
+		sealed[i] = seal(aead, []byte(value), []byte(aad))
+	}
+
+	return Envelope{KeyID: k.primary, WrappedKey: wrapped}, sealed, nil
+}
+
+// Open расшифровывает values, зашифрованные Seal с тем же aad
+func (k *Keyring) Open(env Envelope, aad string, values ...string) ([]string, error) {
+	dataKey, err := k.unwrap(env)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	opened := make([]string, len(values))
+	for i, value := range values {
+		plain, err := open(aead, value, []byte(aad))
+		if err != nil {
+			return nil, err
+		}
+		opened[i] = string(plain)
+	}
+
+	return opened, nil
+}
+
+// Rewrap перешифровывает ключ данных мастер-ключом primary.
+// Сами данные строки при этом не меняются.
+func (k *Keyring) Rewrap(env Envelope) (Envelope, error) {
+	if env.KeyID == k.primary {
+		return env, nil
+	}
+
+	dataKey, err := k.unwrap(env)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	wrapped, err := k.wrap(k.primary, dataKey)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{KeyID: k.primary, WrappedKey: wrapped}, nil
+}
+
+func (k *Keyring) wrap(keyID string, dataKey []byte) (string, error) {
+	key, err := k.key(keyID)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	return seal(aead, dataKey, []byte(keyID)), nil
+}
+
+func (k *Keyring) unwrap(env Envelope) ([]byte, error) {
+	key, err := k.key(env.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, env.WrappedKey, []byte(env.KeyID))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal возвращает base64(nonce || шифротекст)
+func seal(aead cipher.AEAD, plain, aad []byte) string {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	rand.Read(nonce)
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plain, aad))
+}
+
+func open(aead cipher.AEAD, sealed string, aad []byte) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: неверный формат", ErrDecrypt)
+	}
+
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
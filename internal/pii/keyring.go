@@ -0,0 +1,99 @@
+package pii
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// keySize длина ключей AES-256 и HMAC-SHA256
+const keySize = 32
+
+var ErrUnknownKey = errors.New("ключ шифрования не найден в keyring")
+
+// Keyring мастер-ключи (KEK), которыми шифруются ключи данных строк,
+// и ключ blind index. Новые строки шифруются ключом primary,
+// остальные ключи нужны для чтения строк, еще не перешифрованных.
+type Keyring struct {
+	primary  string
+	keys     map[string][]byte
+	indexKey []byte
+}
+
+// keyringFile формат файла keyring, ключи в base64
+type keyringFile struct {
+	Primary  string            `json:"primary"`
+	Keys     map[string]string `json:"keys"`
+	IndexKey string            `json:"index_key"`
+}
+
+// LoadKeyring читает keyring из JSON-файла
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("разбор keyring %s: %w", path, err)
+	}
+
+	keys := make(map[string][]byte, len(file.Keys))
+	for id, encoded := range file.Keys {
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("ключ %q в keyring %s: %w", id, path, err)
+		}
+		keys[id] = key
+	}
+	indexKey, err := decodeKey(file.IndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("index_key в keyring %s: %w", path, err)
+	}
+
+	return NewKeyring(file.Primary, keys, indexKey)
+}
+
+// NewKeyring собирает keyring из ключей длиной 32 байта
+func NewKeyring(primary string, keys map[string][]byte, indexKey []byte) (*Keyring, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("%w: primary %q", ErrUnknownKey, primary)
+	}
+	for id, key := range keys {
+		if len(key) != keySize {
+			return nil, fmt.Errorf("ключ %q: нужно %d байта, получено %d", id, keySize, len(key))
+		}
+	}
+	if len(indexKey) != keySize {
+		return nil, fmt.Errorf("index_key: нужно %d байта, получено %d", keySize, len(indexKey))
+	}
+
+	return &Keyring{primary: primary, keys: keys, indexKey: indexKey}, nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("нужно %d байта, получено %d", keySize, len(key))
+	}
+	return key, nil
+}
+
+// Primary идентификатор ключа, которым шифруются новые строки
+func (k *Keyring) Primary() string {
+	return k.primary
+}
+
+func (k *Keyring) key(id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	return key, nil
+}
@@ -0,0 +1,95 @@
+package pii_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"order-service/internal/pii"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeyring(t *testing.T, primary string) *pii.Keyring {
+	keyring, err := pii.NewKeyring(primary, map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 32),
+	}, bytes.Repeat([]byte{9}, 32))
+	require.NoError(t, err)
+	return keyring
+}
+
+func TestEnvelope(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		keyring := testKeyring(t, "k1")
+
+		env, sealed, err := keyring.Seal("order1", "Test Testov", "test@gmail.com", "")
+		require.NoError(t, err)
+		assert.Equal(t, "k1", env.KeyID)
+		assert.NotContains(t, sealed[1], "test@gmail.com")
+
+		opened, err := keyring.Open(env, "order1", sealed...)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Test Testov", "test@gmail.com", ""}, opened)
+	})
+
+	t.Run("ciphertext bound to row", func(t *testing.T) {
+		keyring := testKeyring(t, "k1")
+
+		env, sealed, err := keyring.Seal("order1", "Test Testov")
+		require.NoError(t, err)
+
+		_, err = keyring.Open(env, "order2", sealed...)
+		assert.ErrorIs(t, err, pii.ErrDecrypt)
+	})
+
+	t.Run("rewrap keeps data readable", func(t *testing.T) {
+		old := testKeyring(t, "k1")
+		env, sealed, err := old.Seal("order1", "Test Testov")
+		require.NoError(t, err)
+
+		rotated := testKeyring(t, "k2")
+		newEnv, err := rotated.Rewrap(env)
+		require.NoError(t, err)
+		assert.Equal(t, "k2", newEnv.KeyID)
+
+		opened, err := rotated.Open(newEnv, "order1", sealed...)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Test Testov"}, opened)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		keyring := testKeyring(t, "k1")
+
+		_, err := keyring.Open(pii.Envelope{KeyID: "k0", WrappedKey: "x"}, "order1", "x")
+		assert.ErrorIs(t, err, pii.ErrUnknownKey)
+	})
+}
+
+func TestBlindIndex(t *testing.T) {
+	keyring := testKeyring(t, "k1")
+
+	assert.Equal(t, keyring.EmailIndex("test@gmail.com"), keyring.EmailIndex(" Test@Gmail.com "))
+	assert.Equal(t, keyring.PhoneIndex("+9720000000"), keyring.PhoneIndex("+972 000-00-00"))
+	assert.NotEqual(t, keyring.EmailIndex("9720000000"), keyring.PhoneIndex("9720000000"))
+	assert.Empty(t, keyring.EmailIndex(""))
+}
+
+func TestLoadKeyring(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	path := filepath.Join(t.TempDir(), "keyring.json")
+
+	require.NoError(t, os.WriteFile(path,
+		[]byte(`{"primary": "k1", "keys": {"k1": "`+key+`"}, "index_key": "`+key+`"}`), 0o600))
+	keyring, err := pii.LoadKeyring(path)
+	require.NoError(t, err)
+	assert.Equal(t, "k1", keyring.Primary())
+
+	require.NoError(t, os.WriteFile(path,
+		[]byte(`{"primary": "k2", "keys": {"k1": "`+key+`"}, "index_key": "`+key+`"}`), 0o600))
+	_, err = pii.LoadKeyring(path)
+	assert.ErrorIs(t, err, pii.ErrUnknownKey)
+}
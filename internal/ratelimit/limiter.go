@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// defaultIdleTTL через сколько без запросов корзина клиента забывается:
+// к этому времени она все равно была бы полной
+const defaultIdleTTL = 10 * time.Minute
+
+// Limiter token bucket на каждого клиента: корзина вмещает burst токенов
+// и пополняется со скоростью rate в секунду, запрос тратит один токен
+type Limiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	idleTTL   time.Duration
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	seen   time.Time
+}
+
+type Option func(l *Limiter)
+
+// WithIdleTTL задает срок, после которого корзина неактивного клиента удаляется
+func WithIdleTTL(ttl time.Duration) Option {
+	return func(l *Limiter) {
+		l.idleTTL = ttl
+	}
+}
+
+func New(rate float64, burst int, opts ...Option) *Limiter {
+	l := &Limiter{
+		rate:    rate,
+		burst:   float64(max(burst, 1)),
+		buckets: make(map[string]*bucket),
+		idleTTL: defaultIdleTTL,
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Allow тратит токен клиента key. Если токенов нет, возвращает false
+// и время, через которое появится следующий.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst}
+		l.buckets[key] = b
+	} else {
+		b.tokens = l.tokens(b, now)
+	}
+	b.seen = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, l.wait(b.tokens)
+}
+
+// Check сообщает, есть ли у клиента key токен, не тратя его.
+// Если токена нет, возвращает false и время, через которое он появится.
+func (l *Limiter) Check(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return true, 0
+	}
+
+	tokens := l.tokens(b, l.now())
+	if tokens >= 1 {
+		return true, 0
+	}
+	return false, l.wait(tokens)
+}
+
+// tokens число токенов корзины к моменту now с учетом пополнения
+func (l *Limiter) tokens(b *bucket, now time.Time) float64 {
+	return math.Min(l.burst, b.tokens+now.Sub(b.seen).Seconds()*l.rate)
+}
+
+func (l *Limiter) wait(tokens float64) time.Duration {
+	return time.Duration((1 - tokens) / l.rate * float64(time.Second))
+}
+
+// Size число отслеживаемых клиентов
+func (l *Limiter) Size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// sweep раз в idleTTL удаляет корзины клиентов, не приходивших дольше idleTTL
+func (l *Limiter) sweep(now time.Time) {
+	if l.lastSweep.IsZero() {
+		l.lastSweep = now
+	}
+	if now.Sub(l.lastSweep) < l.idleTTL {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.seen) >= l.idleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
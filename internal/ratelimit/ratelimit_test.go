@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	l := New(2, 3, WithIdleTTL(time.Minute))
+	l.now = func() time.Time { return now }
+
+	t.Run("burst then refill", func(t *testing.T) {
+		for range 3 {
+			ok, _ := l.Allow("a")
+			require.True(t, ok)
+		}
+
+		ok, wait := l.Allow("a")
+		assert.False(t, ok)
+		assert.Equal(t, 500*time.Millisecond, wait)
+
+		// Другой клиент не делит корзину
+		ok, _ = l.Allow("b")
+		assert.True(t, ok)
+
+		now = now.Add(500 * time.Millisecond)
+		ok, _ = l.Allow("a")
+		assert.True(t, ok)
+	})
+
+	t.Run("check does not spend tokens", func(t *testing.T) {
+		ok, _ := l.Check("new")
+		assert.True(t, ok)
+		assert.Equal(t, 2, l.Size(), "проверка не заводит корзину")
+
+		ok, wait := l.Check("a")
+		assert.False(t, ok)
+		assert.Equal(t, 500*time.Millisecond, wait)
+
+		now = now.Add(500 * time.Millisecond)
+		for range 2 {
+			ok, _ = l.Check("a")
+			assert.True(t, ok)
+		}
+	})
+
+	t.Run("idle buckets are swept", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+		l.Allow("c")
+		assert.Equal(t, 1, l.Size())
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	require.NoError(t, err)
+
+	clientIP := func(remote string, xff ...string) string {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remote
+		for _, v := range xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		return proxies.ClientIP(r)
+	}
+
+	assert.Equal(t, "203.0.113.7", clientIP("203.0.113.7:5000", "1.2.3.4"), "недоверенный клиент не выбирает свой адрес")
+	assert.Equal(t, "1.2.3.4", clientIP("10.1.2.3:5000", "1.2.3.4"))
+	assert.Equal(t, "1.2.3.4", clientIP("10.1.2.3:5000", "6.6.6.6, 1.2.3.4, 192.168.1.1"), "подделанное начало цепочки пропускается")
+	assert.Equal(t, "1.2.3.4", clientIP("10.1.2.3:5000", "6.6.6.6", "1.2.3.4"))
+	assert.Equal(t, "10.1.2.3", clientIP("10.1.2.3:5000"))
+	assert.Equal(t, "10.1.2.3", clientIP("10.1.2.3:5000", "garbage"))
+	assert.Equal(t, "1.2.3.4", clientIP("[::ffff:10.1.2.3]:5000", "1.2.3.4"))
+
+	_, err = ParseTrustedProxies("10.0.0.0/33")
+	assert.Error(t, err)
+}
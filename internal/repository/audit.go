@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+
+	"order-service/internal/audit"
+	"order-service/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const insertAuditSQL = `INSERT INTO order_audit (order_uid, operation, source, changes) VALUES ($1, $2, $3, $4)`
+
+// encryptedValue заменяет в журнале значения полей, которые хранятся зашифрованными
+const encryptedValue = "[encrypted]"
+
+// encryptedFields пути зашифрованных полей доставки в журнале изменений
+var encryptedFields = []string{"delivery.name", "delivery.phone", "delivery.address", "delivery.email"}
+
+// queueAudit добавляет в батч запись журнала об изменении заказа. Источник
+// берется из ctx; запись идет в транзакции изменения и откатывается вместе с ним.
+// При шифровании доставки журнал фиксирует только факт изменения ее персональных полей.
+func (p *DB) queueAudit(ctx context.Context, batch *pgx.Batch, operation string, before, after *models.Order) error {
+	orderUID := ""
+	if after != nil {
+		orderUID = after.OrderUID
+	} else if before != nil {
+		orderUID = before.OrderUID
+	}
+
+	if operation == audit.OpInsert && after.Version == 0 {
+		// Версия нового заказа выставляется после коммита
+		inserted := *after
+		inserted.Version = initialVersion
+		after = &inserted
+	}
+
+	changes, err := audit.Diff(before, after)
+	if err != nil {
+		return fmt.Errorf("журнал заказа %s: %w", orderUID, err)
+	}
+	if p.keyring != nil {
+		maskEncrypted(changes)
+	}
+	source, err := json.Marshal(audit.SourceFor(ctx, orderUID))
+	if err != nil {
+		return err
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("журнал заказа %s: %w", orderUID, err)
+	}
+
+	batch.Queue(insertAuditSQL, orderUID, operation, source, changesJSON)
+	return nil
+}
+
+// maskEncrypted заменяет значения зашифрованных полей на encryptedValue.
+// Возвращает true, если что-то заменено.
+func maskEncrypted(changes map[string]audit.Change) bool {
+	masked := false
+	for _, field := range encryptedFields {
+		change, ok := changes[field]
+		if !ok {
+			continue
+		}
+		if change.Before != nil && change.Before != encryptedValue && change.Before != ErasedValue {
+			change.Before = encryptedValue
+			masked = true
+		}
+		if change.After != nil && change.After != encryptedValue && change.After != ErasedValue {
+			change.After = encryptedValue
+			masked = true
+		}
+		changes[field] = change
+	}
+	return masked
+}
+
+// MaskAuditPII заменяет открытые значения зашифрованных полей доставки
+// в записях журнала, сделанных до включения шифрования. Записи просматриваются
+// пачками по batchSize. Возвращает число измененных записей.
+func (p *DB) MaskAuditPII(ctx context.Context, batchSize int) (int, error) {
+	if p.keyring == nil {
+		return 0, ErrNoKeyring
+	}
+
+	total := 0
+	var lastID int64
+	for {
+		n, next, err := p.maskAuditBatch(ctx, lastID, batchSize)
+		total += n
+		if err != nil || next == lastID {
+			return total, err
+		}
+		lastID = next
+		log.Printf("Маскирование журнала: изменено %d", total)
+	}
+}
+
+// maskAuditBatch обрабатывает записи с id больше afterID.
+// Возвращает число измененных записей и последний просмотренный id.
+func (p *DB) maskAuditBatch(ctx context.Context, afterID int64, batchSize int) (int, int64, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, afterID, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, changes FROM order_audit
+		WHERE id > $1 AND changes ?| $2
+		ORDER BY id
+		LIMIT $3`, afterID, encryptedFields, batchSize)
+	if err != nil {
+		return 0, afterID, err
+	}
+
+	type stored struct {
+		id      int64
+		changes map[string]audit.Change
+	}
+	found, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (stored, error) {
+		var s stored
+		err := row.Scan(&s.id, &s.changes)
+		return s, err
+	})
+	if err != nil || len(found) == 0 {
+		return 0, afterID, err
+	}
+
+	batch := &pgx.Batch{}
+	masked := 0
+	for _, s := range found {
+		if !maskEncrypted(s.changes) {
+			continue
+		}
+		changesJSON, err := json.Marshal(s.changes)
+		if err != nil {
+			return 0, afterID, err
+		}
+		batch.Queue(`SELECT order_audit_mask($1, $2)`, s.id, changesJSON)
+		masked++
+	}
+
+	lastID := found[len(found)-1].id
+	if masked == 0 {
+		return 0, lastID, nil
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return 0, afterID, err
+	}
+
+	return masked, lastID, tx.Commit(ctx)
+}
+
+// GetOrderAudit возвращает журнал изменений заказа от старых записей к новым
+func (p *DB) GetOrderAudit(ctx context.Context, orderUID string) ([]audit.Entry, error) {
+	ctx, cancel := withTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
+	var entries []audit.Entry
+	err := p.read(ctx, orderUID, func(q querier) error {
+		rows, err := q.Query(ctx, `
+			SELECT id, order_uid, operation, source, changes, created_at
+			FROM order_audit WHERE order_uid = $1 ORDER BY id`, orderUID)
+		if err != nil {
+			return err
+		}
+
+		entries, err = pgx.CollectRows(rows, scanAuditEntry)
+		return err
+	})
+
+	return entries, err
+}
+
+func scanAuditEntry(row pgx.CollectableRow) (audit.Entry, error) {
+	var entry audit.Entry
+	var source, changes []byte
+	if err := row.Scan(&entry.ID, &entry.OrderUID, &entry.Operation, &source, &changes, &entry.CreatedAt); err != nil {
+		return entry, err
+	}
+
+	if err := json.Unmarshal(source, &entry.Source); err != nil {
+		return entry, fmt.Errorf("разбор источника записи журнала %d: %w", entry.ID, err)
+	}
+	if changes != nil {
+		if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+			return entry, fmt.Errorf("разбор изменений записи журнала %d: %w", entry.ID, err)
+		}
+	}
+
+	return entry, nil
+}
+
+// sortAuditEntries упорядочивает записи, собранные с нескольких шардов, по времени
+func sortAuditEntries(entries []audit.Entry) {
+	slices.SortStableFunc(entries, func(a, b audit.Entry) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"order-service/internal/audit"
+	"order-service/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveOrders сохраняет пачку заказов одной транзакцией.
+//
+// Каждый заказ вместе с событием outbox пишется одним батчем внутри своей точки
+// сохранения, поэтому ошибка одного заказа (например, дубликат order_uid) откатывает только его.
+// Возвращает срез ошибок по индексам orders (nil - заказ сохранен) и общую
+// ошибку, если не удалось выполнить саму транзакцию - тогда не сохранен ни один заказ.
+func (p *DB) SaveOrders(ctx context.Context, orders []*models.Order) ([]error, error) {
+	results := make([]error, len(orders))
+	if len(orders) == 0 {
+		return results, nil
+	}
+
+	ctx, cancel := withTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	updatedAt := updateTime()
+	for i, order := range orders {
+		order.UpdatedAt = updatedAt
+
+		// SAVEPOINT и RELEASE в том же батче: заказ стоит один round-trip
+		batch := &pgx.Batch{}
+		batch.Queue(`SAVEPOINT save_order`)
+		if err := p.queueOrderInserts(batch, order); err != nil {
+			results[i] = err
+			continue
+		}
+		if err := p.queueOutboxEvent(batch, order); err != nil {
+			results[i] = err
+			continue
+		}
+		if err := p.queueAudit(ctx, batch, audit.OpInsert, nil, order); err != nil {
+			results[i] = err
+			continue
+		}
+		batch.Queue(`RELEASE SAVEPOINT save_order`)
+
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			results[i] = err
+			if _, rbErr := tx.Exec(ctx, `ROLLBACK TO SAVEPOINT save_order`); rbErr != nil {
+				return nil, fmt.Errorf("откат заказа %s: %w", order.OrderUID, rbErr)
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	for i, order := range orders {
+		if results[i] == nil {
+			p.replicas.wrote(order.OrderUID)
+			order.Version = initialVersion
+		}
+	}
+
+	return results, nil
+}
@@ -2,7 +2,9 @@ package repository
 
 import (
 	"container/list"
+	"sort"
 	"sync"
+	"time"
 
 	"order-service/internal/models"
 )
@@ -10,9 +12,23 @@ import (
 // Проверяем, что Cache реализует интерфейс repository.Cache
 var _ OrderCache = (*LRUCache)(nil)
 
+// LRUItem хранит собственную копию заказа: наружу она не отдается,
+// поэтому изменения у вызывающего кода не портят кэш
 type LRUItem struct {
-	order   *models.Order
-	element *list.Element
+	order     *models.Order
+	element   *list.Element
+	expiresAt time.Time // нулевое значение - без срока жизни
+
+	// encoded сериализованные представления заказа по ключу представления
+	// (роль, формат, сжатие). Сбрасываются при каждом Set.
+	encoded map[string]EncodedOrder
+}
+
+// EncodedOrder готовое тело ответа и его хэш для ETag
+type EncodedOrder struct {
+	Data     []byte
+	Hash     string
+	Encoding string // Content-Encoding тела, пусто - без сжатия
 }
 
 type LRUCache struct {
@@ -20,29 +36,80 @@ type LRUCache struct {
 	orders   map[string]*LRUItem
 	list     *list.List
 	capacity int
+	ttl      time.Duration
+
+	// Счетчики для статистики, меняются под mu
+	hits        uint64
+	misses      uint64
+	evictions   uint64
+	expirations uint64
+}
+
+// CacheStats статистика использования кэша
+type CacheStats struct {
+	Size        int     `json:"size"`
+	Capacity    int     `json:"capacity"`
+	Hits        uint64  `json:"hits"`
+	Misses      uint64  `json:"misses"`
+	Evictions   uint64  `json:"evictions"`
+	Expirations uint64  `json:"expirations"`
+	HitRatio    float64 `json:"hit_ratio"`
 }
 
 func NewCache(capacity int) *LRUCache {
+	return NewCacheWithTTL(capacity, 0)
+}
+
+// NewCacheWithTTL создает кэш, записи которого живут не дольше ttl с момента Set.
+// ttl <= 0 - записи не устаревают.
+func NewCacheWithTTL(capacity int, ttl time.Duration) *LRUCache {
 	if capacity <= 0 {
 		capacity = 1000 // дефолтный размер
 	}
+	if ttl < 0 {
+		ttl = 0
+	}
 
 	return &LRUCache{
 		orders:   make(map[string]*LRUItem),
 		list:     list.New(),
 		capacity: capacity,
+		ttl:      ttl,
 	}
 }
 
 func (c *LRUCache) Set(order *models.Order) {
+	c.set(order, false)
+}
+
+// SetIfNewer как Set, но не заменяет закэшированный заказ заказом более старой
+// версии. Возвращает false, если заказ не записан.
+func (c *LRUCache) SetIfNewer(order *models.Order) bool {
+	return c.set(order, true)
+}
+
+// TTL срок жизни записей, 0 - записи не устаревают
+func (c *LRUCache) TTL() time.Duration {
+	return c.ttl
+}
+
+func (c *LRUCache) set(order *models.Order, onlyNewer bool) bool {
+	// Копируем до захвата блокировки
+	order = order.Clone()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	// Если уже существует - обновляем и перемещаем в начало
 	if item, exists := c.orders[order.OrderUID]; exists {
+		if onlyNewer && order.Version < item.order.Version {
+			return false
+		}
 		item.order = order
+		item.encoded = nil
+		item.expiresAt = c.expiry()
 		c.list.MoveToFront(item.element)
-		return
+		return true
 	}
 
 	// Если достигли capacity - удаляем самый старый (инвалидация!)
@@ -52,29 +119,132 @@ func (c *LRUCache) Set(order *models.Order) {
 			oldestItem := oldest.Value.(*LRUItem)
 			delete(c.orders, oldestItem.order.OrderUID)
 			c.list.Remove(oldest)
+			c.evictions++
 		}
 	}
 
 	// Добавляем новый элемент
-	element := c.list.PushFront(&LRUItem{order: order})
-	c.orders[order.OrderUID] = &LRUItem{
-		order:   order,
-		element: element,
+	c.pushFront(order)
+	return true
+}
+
+// pushFront добавляет заказ в начало списка, вызывается под mu
+func (c *LRUCache) pushFront(order *models.Order) {
+	item := &LRUItem{order: order, expiresAt: c.expiry()}
+	item.element = c.list.PushFront(item)
+	c.orders[order.OrderUID] = item
+}
+
+// expiry срок жизни новой записи
+func (c *LRUCache) expiry() time.Time {
+	if c.ttl == 0 {
+		return time.Time{}
 	}
+	return time.Now().Add(c.ttl)
 }
 
 func (c *LRUCache) Get(orderUID string) (*models.Order, bool) {
+	order, _, exists := c.GetWithExpiry(orderUID)
+	return order, exists
+}
+
+// GetWithExpiry как Get, но дополнительно возвращает момент устаревания записи
+// (нулевое время, если TTL выключен). Устаревшая запись удаляется и считается промахом.
+func (c *LRUCache) GetWithExpiry(orderUID string) (*models.Order, time.Time, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	item, exists := c.orders[orderUID]
 	if !exists {
-		return nil, false
+		c.misses++
+		return nil, time.Time{}, false
 	}
 
+	if !item.expiresAt.IsZero() && time.Now().After(item.expiresAt) {
+		c.list.Remove(item.element)
+		delete(c.orders, orderUID)
+		c.expirations++
+		c.misses++
+		return nil, time.Time{}, false
+	}
+	c.hits++
+
 	// Перемещаем в начало (последний использованный)
 	c.list.MoveToFront(item.element)
-	return item.order, true
+	return item.order.Clone(), item.expiresAt, true
+}
+
+// GetEncoded возвращает сохраненное представление view заказа версии version.
+// На статистику попаданий не влияет: заказ уже получен через Get.
+func (c *LRUCache) GetEncoded(orderUID string, version int64, view string) (EncodedOrder, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	item, exists := c.orders[orderUID]
+	if !exists || item.order.Version != version {
+		return EncodedOrder{}, false
+	}
+
+	enc, ok := item.encoded[view]
+	return enc, ok
+}
+
+// SetEncoded сохраняет представление view рядом с заказом. Если заказа нет
+// в кэше или там уже другая версия, представление отбрасывается.
+func (c *LRUCache) SetEncoded(orderUID string, version int64, view string, enc EncodedOrder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, exists := c.orders[orderUID]
+	if !exists || item.order.Version != version {
+		return
+	}
+
+	if item.encoded == nil {
+		item.encoded = make(map[string]EncodedOrder)
+	}
+	item.encoded[view] = enc
+}
+
+func (c *LRUCache) Delete(orderUID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, exists := c.orders[orderUID]
+	if !exists {
+		return
+	}
+
+	c.list.Remove(item.element)
+	delete(c.orders, orderUID)
+}
+
+// Clear удаляет все записи, счетчики статистики сохраняются
+func (c *LRUCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.orders = make(map[string]*LRUItem)
+	c.list = list.New()
+}
+
+// Keys возвращает ключи от недавно использованных к давно использованным.
+// limit <= 0 - без ограничения.
+func (c *LRUCache) Keys(limit int) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	size := c.list.Len()
+	if limit > 0 && limit < size {
+		size = limit
+	}
+
+	keys := make([]string, 0, size)
+	for e := c.list.Front(); e != nil && len(keys) < size; e = e.Next() {
+		keys = append(keys, e.Value.(*LRUItem).order.OrderUID)
+	}
+
+	return keys
 }
 
 func (c *LRUCache) GetAll() map[string]*models.Order {
@@ -83,13 +253,26 @@ func (c *LRUCache) GetAll() map[string]*models.Order {
 
 	result := make(map[string]*models.Order)
 	for key, item := range c.orders {
-		result[key] = item.order
+		result[key] = item.order.Clone()
 	}
 
 	return result
 }
 
 func (c *LRUCache) Restore(orders map[string]*models.Order) {
+	// Порядок обхода map случайный, поэтому сортируем: самые свежие заказы
+	// попадают в кэш первыми и оказываются в начале списка
+	sorted := make([]*models.Order, 0, len(orders))
+	for _, order := range orders {
+		sorted = append(sorted, order)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].DateCreated.Equal(sorted[j].DateCreated) {
+			return sorted[i].DateCreated.After(sorted[j].DateCreated)
+		}
+		return sorted[i].OrderUID < sorted[j].OrderUID
+	})
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -97,17 +280,15 @@ func (c *LRUCache) Restore(orders map[string]*models.Order) {
 	c.list = list.New()
 
 	// Добавляем элементы пока не достигнем capacity
-	for _, order := range orders {
+	for _, order := range sorted {
 		// Если достигли capacity - выходим
 		if c.list.Len() >= c.capacity {
 			break
 		}
 
-		element := c.list.PushFront(&LRUItem{order: order})
-		c.orders[order.OrderUID] = &LRUItem{
-			order:   order,
-			element: element,
-		}
+		item := &LRUItem{order: order.Clone(), expiresAt: c.expiry()}
+		item.element = c.list.PushBack(item)
+		c.orders[order.OrderUID] = item
 	}
 }
 
@@ -116,3 +297,22 @@ func (c *LRUCache) Size() int {
 	defer c.mu.RUnlock()
 	return len(c.orders)
 }
+
+func (c *LRUCache) Stats() CacheStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stats := CacheStats{
+		Size:        len(c.orders),
+		Capacity:    c.capacity,
+		Hits:        c.hits,
+		Misses:      c.misses,
+		Evictions:   c.evictions,
+		Expirations: c.expirations,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRatio = float64(c.hits) / float64(total)
+	}
+
+	return stats
+}
@@ -2,7 +2,9 @@ package repository_test
 
 import (
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"order-service/internal/models"
 	"order-service/internal/repository"
@@ -59,6 +61,18 @@ func TestLRUCache(t *testing.T) {
 		assert.Equal(t, "new", result.TrackNumber)
 	})
 
+	t.Run("set if newer keeps newer version", func(t *testing.T) {
+		cache := repository.NewCache(2)
+
+		assert.True(t, cache.SetIfNewer(&models.Order{OrderUID: "order1", Version: 2, TrackNumber: "v2"}))
+		assert.False(t, cache.SetIfNewer(&models.Order{OrderUID: "order1", Version: 1, TrackNumber: "v1"}))
+		assert.True(t, cache.SetIfNewer(&models.Order{OrderUID: "order1", Version: 2, TrackNumber: "v2 again"}))
+
+		result, exists := cache.Get("order1")
+		assert.True(t, exists)
+		assert.Equal(t, "v2 again", result.TrackNumber)
+	})
+
 	t.Run("get moves to front", func(t *testing.T) {
 		cache := repository.NewCache(3)
 
@@ -122,6 +136,79 @@ func TestLRUCache(t *testing.T) {
 		assert.Equal(t, order2, allOrders["order2"])
 	})
 
+	t.Run("delete", func(t *testing.T) {
+		cache := repository.NewCache(3)
+
+		cache.Set(&models.Order{OrderUID: "order1"})
+		cache.Set(&models.Order{OrderUID: "order2"})
+
+		cache.Delete("order1")
+		cache.Delete("missing") // не должно паниковать
+
+		_, exists := cache.Get("order1")
+		assert.False(t, exists, "order1 should be deleted")
+		assert.Equal(t, 1, cache.Size())
+	})
+
+	t.Run("keys in recency order", func(t *testing.T) {
+		cache := repository.NewCache(3)
+
+		cache.Set(&models.Order{OrderUID: "order1"})
+		cache.Set(&models.Order{OrderUID: "order2"})
+		cache.Set(&models.Order{OrderUID: "order3"})
+		cache.Get("order1")
+
+		assert.Equal(t, []string{"order1", "order3", "order2"}, cache.Keys(0))
+		assert.Equal(t, []string{"order1", "order3"}, cache.Keys(2))
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		cache := repository.NewCache(2)
+
+		cache.Set(&models.Order{OrderUID: "order1"})
+		cache.Set(&models.Order{OrderUID: "order2"})
+		cache.Set(&models.Order{OrderUID: "order3"}) // вытесняет order1
+
+		cache.Get("order2")
+		cache.Get("order3")
+		cache.Get("order1")
+
+		stats := cache.Stats()
+		assert.Equal(t, 2, stats.Size)
+		assert.Equal(t, 2, stats.Capacity)
+		assert.Equal(t, uint64(2), stats.Hits)
+		assert.Equal(t, uint64(1), stats.Misses)
+		assert.Equal(t, uint64(1), stats.Evictions)
+		assert.InDelta(t, 2.0/3.0, stats.HitRatio, 0.001)
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		cache := repository.NewCache(2)
+
+		cache.Set(&models.Order{OrderUID: "order1"})
+		cache.Clear()
+
+		assert.Equal(t, 0, cache.Size())
+		assert.Empty(t, cache.Keys(0))
+	})
+
+	t.Run("ttl expiry", func(t *testing.T) {
+		cache := repository.NewCacheWithTTL(2, 50*time.Millisecond)
+
+		cache.Set(&models.Order{OrderUID: "order1"})
+
+		_, expiresAt, exists := cache.GetWithExpiry("order1")
+		assert.True(t, exists)
+		assert.False(t, expiresAt.IsZero())
+
+		time.Sleep(60 * time.Millisecond)
+
+		_, exists = cache.Get("order1")
+		assert.False(t, exists, "order1 should be expired")
+		assert.Equal(t, 0, cache.Size())
+		assert.Equal(t, uint64(1), cache.Stats().Expirations)
+	})
+
 	t.Run("size", func(t *testing.T) {
 		cache := repository.NewCache(3)
 
@@ -184,3 +271,176 @@ func TestLRUCache_EdgeCases(t *testing.T) {
 		assert.True(t, cache.Size() <= 100)
 	})
 }
+
+// consistentOrder строит заказ, все поля которого согласованы с номером версии.
+// Читатель, увидевший смесь версий, найдет расхождение в checkConsistent.
+func consistentOrder(orderUID string, version int) *models.Order {
+	track := fmt.Sprintf("track-%d", version)
+	items := make([]models.Item, 3)
+	total := 0
+	for i := range items {
+		items[i] = models.Item{ChrtID: version, TrackNumber: track, TotalPrice: version}
+		total += version
+	}
+
+	return &models.Order{
+		OrderUID:    orderUID,
+		TrackNumber: track,
+		SmID:        version,
+		Items:       items,
+		Payment:     models.Payment{GoodsTotal: total},
+	}
+}
+
+func checkConsistent(t *testing.T, order *models.Order) {
+	t.Helper()
+
+	version := order.SmID
+	track := fmt.Sprintf("track-%d", version)
+	if order.TrackNumber != track || len(order.Items) != 3 || order.Payment.GoodsTotal != 3*version {
+		t.Errorf("torn order: %+v", order)
+		return
+	}
+	for _, item := range order.Items {
+		if item.ChrtID != version || item.TrackNumber != track {
+			t.Errorf("torn item in order version %d: %+v", version, item)
+		}
+	}
+}
+
+func TestLRUCache_Immutability(t *testing.T) {
+	t.Run("mutating argument of Set does not change cache", func(t *testing.T) {
+		cache := repository.NewCache(2)
+
+		order := consistentOrder("order1", 1)
+		cache.Set(order)
+
+		order.TrackNumber = "mutated"
+		order.Items[0].Name = "mutated"
+
+		result, exists := cache.Get("order1")
+		assert.True(t, exists)
+		checkConsistent(t, result)
+	})
+
+	t.Run("mutating result of Get does not change cache", func(t *testing.T) {
+		cache := repository.NewCache(2)
+		cache.Set(consistentOrder("order1", 1))
+
+		result, _ := cache.Get("order1")
+		result.TrackNumber = "mutated"
+		result.Items[0].TrackNumber = "mutated"
+		result.Items = append(result.Items, models.Item{})
+
+		result, _ = cache.Get("order1")
+		checkConsistent(t, result)
+	})
+
+	t.Run("mutating GetAll result does not change cache", func(t *testing.T) {
+		cache := repository.NewCache(2)
+		cache.Set(consistentOrder("order1", 1))
+
+		all := cache.GetAll()
+		all["order1"].Items[0].ChrtID = 42
+
+		result, _ := cache.Get("order1")
+		checkConsistent(t, result)
+	})
+
+	t.Run("restore copies orders", func(t *testing.T) {
+		cache := repository.NewCache(2)
+
+		order := consistentOrder("order1", 1)
+		cache.Restore(map[string]*models.Order{"order1": order})
+		order.Items[1].TrackNumber = "mutated"
+
+		result, _ := cache.Get("order1")
+		checkConsistent(t, result)
+	})
+
+	// Запускать с -race: читатели мутируют полученные копии,
+	// писатели перезаписывают те же ключи новыми версиями
+	t.Run("concurrent readers and writers", func(t *testing.T) {
+		const (
+			keys       = 4
+			writers    = 4
+			readers    = 8
+			iterations = 500
+		)
+
+		cache := repository.NewCache(keys)
+		for k := range keys {
+			cache.Set(consistentOrder(fmt.Sprintf("order%d", k), 0))
+		}
+
+		var wg sync.WaitGroup
+		for w := range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range iterations {
+					order := consistentOrder(fmt.Sprintf("order%d", i%keys), w*iterations+i)
+					cache.Set(order)
+					// Писатель продолжает менять свой экземпляр после Set
+					order.TrackNumber = "mutated-after-set"
+					order.Items[0].ChrtID = -1
+				}
+			}()
+		}
+
+		for range readers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range iterations {
+					key := fmt.Sprintf("order%d", i%keys)
+					order, exists := cache.Get(key)
+					if !exists {
+						t.Errorf("%s missing", key)
+						continue
+					}
+					checkConsistent(t, order)
+
+					order.TrackNumber = "mutated-by-reader"
+					order.Items[1].TrackNumber = "mutated-by-reader"
+
+					for _, o := range cache.GetAll() {
+						checkConsistent(t, o)
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		for _, order := range cache.GetAll() {
+			checkConsistent(t, order)
+		}
+	})
+}
+
+func TestLRUCache_Encoded(t *testing.T) {
+	cache := repository.NewCache(2)
+	cache.Set(&models.Order{OrderUID: "order1", Version: 1})
+	enc := repository.EncodedOrder{Data: []byte(`{"order_uid":"order1"}`), Hash: "abc"}
+
+	// Представление для другой версии или отсутствующего заказа не сохраняется
+	cache.SetEncoded("order1", 2, "admin", enc)
+	cache.SetEncoded("order2", 1, "admin", enc)
+	_, ok := cache.GetEncoded("order1", 2, "admin")
+	assert.False(t, ok)
+	_, ok = cache.GetEncoded("order2", 1, "admin")
+	assert.False(t, ok)
+
+	cache.SetEncoded("order1", 1, "admin", enc)
+	got, ok := cache.GetEncoded("order1", 1, "admin")
+	assert.True(t, ok)
+	assert.Equal(t, enc, got)
+	_, ok = cache.GetEncoded("order1", 1, "support")
+	assert.False(t, ok, "представления разных ролей хранятся отдельно")
+
+	// Новая запись заказа сбрасывает старые представления
+	cache.Set(&models.Order{OrderUID: "order1", Version: 1})
+	_, ok = cache.GetEncoded("order1", 1, "admin")
+	assert.False(t, ok)
+}
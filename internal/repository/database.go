@@ -2,185 +2,476 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 
+	"order-service/internal/audit"
 	"order-service/internal/models"
+	"order-service/internal/pii"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var _ OrderRepository = (*DB)(nil)
 
+var (
+	ErrOrderNotFound   = errors.New("заказ не найден")
+	ErrIncompleteOrder = errors.New("заказ сохранен не полностью")
+)
+
+// initialVersion версия нового заказа, DEFAULT колонки orders.version
+const initialVersion = 1
+
 type DB struct {
 	pool *pgxpool.Pool
+	// nil, если реплики не заданы
+	replicas *replicaSet
+	// Сроки операций с одним заказом и загрузки списков, 0 - без ограничения
+	queryTimeout time.Duration
+	bulkTimeout  time.Duration
+	// nil, если персональные данные доставки хранятся открыто
+	keyring *pii.Keyring
 }
 
-func NewDB(connectionString string) (*DB, error) {
-	cfg, err := pgxpool.ParseConfig(connectionString)
-	if err != nil {
-		return nil, err
+func NewDB(connectionString string, opts ...Option) (*DB, error) {
+	o := &options{
+		replicaCheckInterval: defaultReplicaCheckInterval,
+		readYourWritesWindow: defaultReadYourWritesWindow,
+	}
+	for _, opt := range opts {
+		opt(o)
 	}
 
-	cfg.MaxConns = 10
-	cfg.MinConns = 1
-
-	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	ctx := context.Background()
+	pool, err := newPool(ctx, connectionString, o.pool)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := pool.Ping(context.Background()); err != nil {
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
 		return nil, err
 	}
 
-	return &DB{pool: pool}, nil
+	db := &DB{pool: pool, queryTimeout: o.queryTimeout, bulkTimeout: o.bulkTimeout, keyring: o.keyring}
+	if len(o.replicaURLs) > 0 {
+		db.replicas, err = newReplicaSet(ctx, o)
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+	}
+
+	return db, nil
 }
 
 func (p *DB) Close() {
+	p.replicas.close()
 	p.pool.Close()
 }
 
+const (
+	insertOrderKeySQL = `INSERT INTO order_keys (order_uid, date_created) VALUES ($1, $2)`
+
+	insertOrderSQL = `INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, 
+		 customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, updated_at) 
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+	insertDeliverySQL = `INSERT INTO deliveries (order_uid, name, phone, zip, city, address, region, email,
+		 key_id, wrapped_key, email_hash, phone_hash)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+	insertPaymentSQL = `INSERT INTO payments (order_uid, transaction, request_id, currency, provider, 
+		 amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+	insertItemSQL = `INSERT INTO items (order_uid, date_created, chrt_id, track_number, price, rid, name, sale, size, 
+		 total_price, nm_id, brand, status) 
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+)
+
+// SaveOrder сохраняет новый заказ и выставляет ему начальную версию и время изменения.
+// updated_at из входных данных не сохраняется: по нему сверяется снапшот кэша.
 func (p *DB) SaveOrder(ctx context.Context, order *models.Order) error {
+	ctx, cancel := withTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
+	order.UpdatedAt = updateTime()
+
 	tx, err := p.pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx)
 
-	// Order
-	_, err = tx.Exec(ctx,
-		`INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, 
-		 customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard) 
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
-		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
-		order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard)
-	if err != nil {
+	// Все вставки заказа и событие о нем уходят в бд одним батчем
+	batch := &pgx.Batch{}
+	if err := p.queueOrderInserts(batch, order); err != nil {
+		return err
+	}
+	if err := p.queueOutboxEvent(batch, order); err != nil {
+		return err
+	}
+	if err := p.queueAudit(ctx, batch, audit.OpInsert, nil, order); err != nil {
+		return err
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
 		return err
 	}
 
-	// Delivery
-	_, err = tx.Exec(ctx,
-		`INSERT INTO deliveries (order_uid, name, phone, zip, city, address, region, email)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
-		order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip,
-		order.Delivery.City, order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	p.replicas.wrote(order.OrderUID)
+	order.Version = initialVersion
+	return nil
+}
+
+// updateTime текущее время с точностью, которую хранит бд
+func updateTime() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// queueOrderInserts добавляет в батч вставку заказа со всеми дочерними строками.
+// Время изменения выставляет вызывающий.
+func (p *DB) queueOrderInserts(batch *pgx.Batch, order *models.Order) error {
+	delivery, err := p.sealDelivery(order.OrderUID, &order.Delivery)
 	if err != nil {
 		return err
 	}
 
+	// Order
+	batch.Queue(insertOrderKeySQL, order.OrderUID, order.DateCreated)
+	batch.Queue(insertOrderSQL,
+		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
+		order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard,
+		order.UpdatedAt)
+
+	// Delivery
+	batch.Queue(insertDeliverySQL,
+		order.OrderUID, delivery.Name, delivery.Phone, order.Delivery.Zip,
+		order.Delivery.City, delivery.Address, order.Delivery.Region, delivery.Email,
+		delivery.KeyID, delivery.WrappedKey, delivery.EmailHash, delivery.PhoneHash)
+
 	// Payment
-	_, err = tx.Exec(ctx,
-		`INSERT INTO payments (order_uid, transaction, request_id, currency, provider, 
-		 amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+	batch.Queue(insertPaymentSQL,
 		order.OrderUID, order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency,
 		order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDt, order.Payment.Bank,
 		order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee)
-	if err != nil {
-		return err
-	}
 
 	// Items
 	for _, item := range order.Items {
-		_, err = tx.Exec(ctx,
-			`INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name, sale, size, 
-			 total_price, nm_id, brand, status) 
-			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
-			order.OrderUID, item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name,
+		batch.Queue(insertItemSQL,
+			order.OrderUID, order.DateCreated, item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name,
 			item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status)
-		if err != nil {
-			return err
-		}
 	}
 
-	return tx.Commit(ctx)
+	return nil
 }
 
-func (p *DB) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
-	query := `
-		SELECT 
+// selectOrderSQL читает заказ целиком за один round-trip: доставка и оплата
+// приходят как jsonb (NULL, если строки нет), товары агрегируются в jsonb-массив.
+// Товары ищутся и по date_created, чтобы отсекались лишние секции items.
+// Ключ шифрования доставки читается отдельными колонками.
+const selectOrderSQL = `
+		SELECT
 			o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
-			o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
-			d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
-			p.transaction, p.request_id, p.currency, p.provider, p.amount, p.payment_dt,
-			p.bank, p.delivery_cost, p.goods_total, p.custom_fee
+			o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard, o.version, o.updated_at,
+			to_jsonb(d) - 'order_uid' - 'key_id' - 'wrapped_key' - 'email_hash' - 'phone_hash',
+			d.key_id, d.wrapped_key,
+			to_jsonb(p) - 'order_uid',
+			(SELECT jsonb_agg(to_jsonb(i) - 'order_uid' - 'date_created') FROM items i
+			 WHERE i.order_uid = o.order_uid AND i.date_created = o.date_created)
 		FROM orders o
 		LEFT JOIN deliveries d ON o.order_uid = d.order_uid
-		LEFT JOIN payments p ON o.order_uid = p.order_uid
-		WHERE o.order_uid = $1
-	`
+		LEFT JOIN payments p ON o.order_uid = p.order_uid`
+
+// Точечные запросы берут date_created из order_keys: подзапрос с параметром
+// отсекает лишние секции orders и items при выполнении.
+const (
+	// orderKeyWhere условие для одного заказа с order_uid в $1
+	orderKeyWhere = ` WHERE o.order_uid = $1 AND o.date_created = (SELECT date_created FROM order_keys WHERE order_uid = $1)`
+	// orderKeysWhere условие для заказов с order_uid из массива $1
+	orderKeysWhere = ` WHERE o.order_uid = ANY($1)
+		AND (o.order_uid, o.date_created) IN (SELECT order_uid, date_created FROM order_keys WHERE order_uid = ANY($1))`
+)
+
+func (p *DB) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	ctx, cancel := withTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
+	var order *models.Order
+	err := p.read(ctx, orderUID, func(q querier) error {
+		var err error
+		order, err = p.scanOrder(q.QueryRow(ctx, selectOrderSQL+orderKeyWhere, orderUID))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrOrderNotFound, orderUID)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	row := p.pool.QueryRow(ctx, query, orderUID)
+	return order, nil
+}
 
+// scanOrder разбирает строку selectOrderSQL и расшифровывает доставку
+func (p *DB) scanOrder(row pgx.Row) (*models.Order, error) {
 	var order models.Order
-	var delivery models.Delivery
-	var payment models.Payment
+	var delivery, payment, items []byte
+	var keyID, wrappedKey *string
 
 	err := row.Scan(
 		&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature,
 		&order.CustomerID, &order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard,
-		&delivery.Name, &delivery.Phone, &delivery.Zip, &delivery.City, &delivery.Address, &delivery.Region, &delivery.Email,
-		&payment.Transaction, &payment.RequestID, &payment.Currency, &payment.Provider, &payment.Amount, &payment.PaymentDt,
-		&payment.Bank, &payment.DeliveryCost, &payment.GoodsTotal, &payment.CustomFee,
+		&order.Version, &order.UpdatedAt, &delivery, &keyID, &wrappedKey, &payment, &items,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	order.Delivery = delivery
-	order.Payment = payment
+	if delivery == nil {
+		return nil, fmt.Errorf("%w: нет доставки для заказа %s", ErrIncompleteOrder, order.OrderUID)
+	}
+	if payment == nil {
+		return nil, fmt.Errorf("%w: нет оплаты для заказа %s", ErrIncompleteOrder, order.OrderUID)
+	}
 
-	// Items
-	rows, err := p.pool.Query(ctx,
-		`SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status 
-		 FROM items WHERE order_uid = $1`, orderUID)
-	if err != nil {
+	if err := json.Unmarshal(delivery, &order.Delivery); err != nil {
+		return nil, fmt.Errorf("разбор доставки заказа %s: %w", order.OrderUID, err)
+	}
+	if err := p.openDelivery(order.OrderUID, &order.Delivery, keyID, wrappedKey); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var items []models.Item
-	for rows.Next() {
-		var item models.Item
-		if err := rows.Scan(
-			&item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name, &item.Sale, &item.Size,
-			&item.TotalPrice, &item.NmID, &item.Brand, &item.Status,
-		); err != nil {
-			return nil, err
+	if err := json.Unmarshal(payment, &order.Payment); err != nil {
+		return nil, fmt.Errorf("разбор оплаты заказа %s: %w", order.OrderUID, err)
+	}
+	if items != nil {
+		if err := json.Unmarshal(items, &order.Items); err != nil {
+			return nil, fmt.Errorf("разбор товаров заказа %s: %w", order.OrderUID, err)
 		}
-		items = append(items, item)
 	}
 
-	order.Items = items
 	return &order, nil
 }
 
 func (p *DB) GetAllOrders(ctx context.Context) (map[string]*models.Order, error) {
-	rows, err := p.pool.Query(ctx, `SELECT order_uid FROM orders`)
+	return p.loadOrders(ctx, ``)
+}
+
+// GetOrdersUpdatedSince возвращает заказы, созданные или измененные после since
+func (p *DB) GetOrdersUpdatedSince(ctx context.Context, since time.Time) (map[string]*models.Order, error) {
+	return p.loadOrders(ctx, `WHERE o.updated_at > $1`, since)
+}
+
+// StreamOrdersBefore передает в fn по одному заказы, созданные раньше cutoff,
+// в порядке date_created. Ошибка fn прерывает чтение.
+// Читает из primary: выгруженные заказы затем удаляются.
+func (p *DB) StreamOrdersBefore(ctx context.Context, cutoff time.Time, fn func(order *models.Order) error) error {
+	tx, err := relaxedTx(ctx, p.pool, 0)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, selectOrderSQL+` WHERE o.date_created < $1 ORDER BY o.date_created`, cutoff)
+	if err != nil {
+		return err
 	}
 	defer rows.Close()
 
-	orders := make(map[string]*models.Order)
 	for rows.Next() {
-		var orderUID string
-		if err := rows.Scan(&orderUID); err != nil {
+		order, err := p.scanOrder(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(order); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// DeleteOrders удаляет заказы со всеми дочерними строками одной транзакцией
+func (p *DB) DeleteOrders(ctx context.Context, orderUIDs []string) error {
+	_, err := p.deleteOrders(ctx, orderUIDs, nil)
+	return err
+}
+
+// DeleteOrderVersions удаляет заказы, версия которых все еще равна versions[order_uid].
+// Заказы, измененные с момента чтения, остаются в бд.
+// Возвращает order_uid удаленных заказов.
+func (p *DB) DeleteOrderVersions(ctx context.Context, versions map[string]int64) ([]string, error) {
+	return p.deleteOrders(ctx, slices.Collect(maps.Keys(versions)), func(order *models.Order) bool {
+		return order.Version == versions[order.OrderUID]
+	})
+}
+
+// deleteOrders удаляет одной транзакцией заказы, для которых keep (если задан)
+// возвращает true, и возвращает их order_uid. Удаляет пачки архивации и
+// переноса шардов, поэтому сроком не ограничивается.
+func (p *DB) deleteOrders(ctx context.Context, orderUIDs []string, keep func(order *models.Order) bool) ([]string, error) {
+	tx, err := relaxedTx(ctx, p.pool, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Удаляемые заказы нужны журналу целиком
+	rows, err := tx.Query(ctx, selectOrderSQL+orderKeysWhere+` FOR UPDATE OF o`, orderUIDs)
+	if err != nil {
+		return nil, err
+	}
+	found, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.Order, error) {
+		return p.scanOrder(row)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make([]string, 0, len(found))
+	batch := &pgx.Batch{}
+	for _, order := range found {
+		if keep != nil && !keep(order) {
 			continue
 		}
+		deleted = append(deleted, order.OrderUID)
+		if err := p.queueAudit(ctx, batch, audit.OpDelete, order, nil); err != nil {
+			return nil, err
+		}
+	}
+	if len(deleted) == 0 {
+		return deleted, nil
+	}
+	queueOrderDeletes(batch, deleted)
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
 
-		order, err := p.GetOrder(ctx, orderUID)
+	p.replicas.wrote(deleted...)
+	return deleted, nil
+}
+
+// queueOrderDeletes добавляет в батч удаление заказов со всеми дочерними строками
+func queueOrderDeletes(batch *pgx.Batch, orderUIDs []string) {
+	batch.Queue(`DELETE FROM items WHERE order_uid = ANY($1)
+		AND (order_uid, date_created) IN (SELECT order_uid, date_created FROM order_keys WHERE order_uid = ANY($1))`, orderUIDs)
+	batch.Queue(`DELETE FROM deliveries WHERE order_uid = ANY($1)`, orderUIDs)
+	batch.Queue(`DELETE FROM payments WHERE order_uid = ANY($1)`, orderUIDs)
+	batch.Queue(`DELETE FROM orders o`+orderKeysWhere, orderUIDs)
+	batch.Queue(`DELETE FROM order_keys WHERE order_uid = ANY($1)`, orderUIDs)
+}
+
+// ListOrderUIDs возвращает идентификаторы всех заказов от новых к старым
+func (p *DB) ListOrderUIDs(ctx context.Context) ([]string, error) {
+	keys, err := p.listOrderKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	uids := make([]string, len(keys))
+	for i, key := range keys {
+		uids[i] = key.OrderUID
+	}
+	return uids, nil
+}
+
+// orderKey идентификатор заказа с датой создания для упорядочивания
+type orderKey struct {
+	OrderUID    string
+	DateCreated time.Time
+}
+
+// compareOrderKeys упорядочивает заказы от новых к старым
+func compareOrderKeys(a, b orderKey) int {
+	if c := b.DateCreated.Compare(a.DateCreated); c != 0 {
+		return c
+	}
+	return strings.Compare(a.OrderUID, b.OrderUID)
+}
+
+func (p *DB) listOrderKeys(ctx context.Context) ([]orderKey, error) {
+	ctx, cancel := withTimeout(ctx, p.bulkTimeout)
+	defer cancel()
+
+	var keys []orderKey
+	err := p.read(ctx, "", func(q querier) error {
+		tx, err := relaxedTx(ctx, q, p.bulkTimeout)
 		if err != nil {
-			log.Printf("Ошибка загрузки заказа %s: %v", orderUID, err)
-			continue
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		rows, err := tx.Query(ctx, `SELECT order_uid, date_created FROM orders ORDER BY date_created DESC, order_uid`)
+		if err != nil {
+			return err
 		}
 
-		orders[orderUID] = order
+		keys, err = pgx.CollectRows(rows, pgx.RowToStructByPos[orderKey])
+		return err
+	})
+
+	return keys, err
+}
+
+// loadOrders загружает одним запросом заказы, подходящие под условие where.
+// Неполные заказы пропускаются с записью в лог. statement_timeout сессии
+// заменяется сроком загрузки списков, чтобы большой список успел загрузиться.
+func (p *DB) loadOrders(ctx context.Context, where string, args ...any) (map[string]*models.Order, error) {
+	ctx, cancel := withTimeout(ctx, p.bulkTimeout)
+	defer cancel()
+
+	var orders map[string]*models.Order
+	err := p.read(ctx, "", func(q querier) error {
+		tx, err := relaxedTx(ctx, q, p.bulkTimeout)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		rows, err := tx.Query(ctx, selectOrderSQL+" "+where, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		orders = make(map[string]*models.Order)
+		for rows.Next() {
+			order, err := p.scanOrder(rows)
+			if err != nil {
+				log.Printf("Ошибка загрузки заказа: %v", err)
+				continue
+			}
+
+			orders[order.OrderUID] = order
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return orders, nil
 }
 
 func (p *DB) HealthCheck(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
 	return p.pool.Ping(ctx)
 }
@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"order-service/internal/models"
+	"order-service/internal/pii"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrNoKeyring = errors.New("шифрование персональных данных не настроено")
+
+// deliveryRow персональные поля доставки в том виде, в каком они хранятся в бд.
+// Без keyring поля хранятся открыто, а KeyID и хэши - NULL.
+type deliveryRow struct {
+	Name, Phone, Address, Email string
+	KeyID, WrappedKey           *string
+	EmailHash, PhoneHash        *string
+}
+
+// sealDelivery шифрует имя, телефон, адрес и email доставки, если задан keyring.
+// Шифротекст привязан к order_uid.
+func (p *DB) sealDelivery(orderUID string, d *models.Delivery) (deliveryRow, error) {
+	if p.keyring == nil {
+		return deliveryRow{Name: d.Name, Phone: d.Phone, Address: d.Address, Email: d.Email}, nil
+	}
+
+	env, sealed, err := p.keyring.Seal(orderUID, d.Name, d.Phone, d.Address, d.Email)
+	if err != nil {
+		return deliveryRow{}, fmt.Errorf("шифрование доставки заказа %s: %w", orderUID, err)
+	}
+
+	return deliveryRow{
+		Name: sealed[0], Phone: sealed[1], Address: sealed[2], Email: sealed[3],
+		KeyID: &env.KeyID, WrappedKey: &env.WrappedKey,
+		EmailHash: nullIfEmpty(p.keyring.EmailIndex(d.Email)),
+		PhoneHash: nullIfEmpty(p.keyring.PhoneIndex(d.Phone)),
+	}, nil
+}
+
+// openDelivery расшифровывает поля доставки, прочитанные из бд.
+// Строки без keyID хранятся открыто и возвращаются как есть.
+func (p *DB) openDelivery(orderUID string, d *models.Delivery, keyID, wrappedKey *string) error {
+	if keyID == nil {
+		return nil
+	}
+	if p.keyring == nil {
+		return fmt.Errorf("%w: доставка заказа %s зашифрована ключом %q", ErrNoKeyring, orderUID, *keyID)
+	}
+
+	env := pii.Envelope{KeyID: *keyID}
+	if wrappedKey != nil {
+		env.WrappedKey = *wrappedKey
+	}
+	opened, err := p.keyring.Open(env, orderUID, d.Name, d.Phone, d.Address, d.Email)
+	if err != nil {
+		return fmt.Errorf("расшифровка доставки заказа %s: %w", orderUID, err)
+	}
+
+	d.Name, d.Phone, d.Address, d.Email = opened[0], opened[1], opened[2], opened[3]
+	return nil
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// phoneDigits оставляет в номере только цифры, как PhoneIndex
+var phoneDigits = regexp.MustCompile(`\D`)
+
+// FindOrderUIDsByContact ищет заказы по email и/или телефону доставки.
+// Зашифрованные строки находятся по blind index, открытые - по значению.
+func (p *DB) FindOrderUIDsByContact(ctx context.Context, email, phone string) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
+	var conds []string
+	var args []any
+	if email != "" {
+		args = append(args, strings.ToLower(strings.TrimSpace(email)))
+		cond := fmt.Sprintf(`(key_id IS NULL AND lower(trim(email)) = $%d)`, len(args))
+		if p.keyring != nil {
+			args = append(args, p.keyring.EmailIndex(email))
+			cond = fmt.Sprintf(`(%s OR email_hash = $%d)`, cond, len(args))
+		}
+		conds = append(conds, cond)
+	}
+	if phone != "" {
+		args = append(args, phoneDigits.ReplaceAllString(phone, ""))
+		cond := fmt.Sprintf(`(key_id IS NULL AND regexp_replace(phone, '\D', '', 'g') = $%d)`, len(args))
+		if p.keyring != nil {
+			args = append(args, p.keyring.PhoneIndex(phone))
+			cond = fmt.Sprintf(`(%s OR phone_hash = $%d)`, cond, len(args))
+		}
+		conds = append(conds, cond)
+	}
+	if len(conds) == 0 {
+		return nil, nil
+	}
+
+	var uids []string
+	err := p.read(ctx, "", func(q querier) error {
+		rows, err := q.Query(ctx,
+			`SELECT order_uid FROM deliveries WHERE `+strings.Join(conds, " AND ")+` ORDER BY order_uid`, args...)
+		if err != nil {
+			return err
+		}
+
+		uids, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		return err
+	})
+
+	return uids, err
+}
+
+// ReencryptDeliveries переводит доставки на ключ primary пачками по batchSize строк:
+// у зашифрованных старым ключом перешифровывается только ключ данных,
+// открытые строки шифруются целиком. Обезличенные заказы не трогаются.
+// Возвращает число обработанных строк.
+func (p *DB) ReencryptDeliveries(ctx context.Context, batchSize int) (int, error) {
+	if p.keyring == nil {
+		return 0, ErrNoKeyring
+	}
+
+	total := 0
+	for {
+		n, err := p.reencryptBatch(ctx, batchSize)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			return total, nil
+		}
+		log.Printf("Перешифровка доставок: обработано %d", total)
+	}
+}
+
+func (p *DB) reencryptBatch(ctx context.Context, batchSize int) (int, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// SKIP LOCKED: работу можно запускать параллельно с записью заказов
+	rows, err := tx.Query(ctx, `
+		SELECT d.order_uid, d.name, d.phone, d.address, d.email, d.key_id, d.wrapped_key
+		FROM deliveries d
+		JOIN orders o ON o.order_uid = d.order_uid
+		WHERE d.key_id IS DISTINCT FROM $1 AND o.erased_at IS NULL
+		ORDER BY d.order_uid
+		LIMIT $2
+		FOR UPDATE OF d SKIP LOCKED`, p.keyring.Primary(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	type stored struct {
+		orderUID   string
+		delivery   models.Delivery
+		keyID      *string
+		wrappedKey *string
+	}
+	found, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (stored, error) {
+		var s stored
+		err := row.Scan(&s.orderUID, &s.delivery.Name, &s.delivery.Phone, &s.delivery.Address,
+			&s.delivery.Email, &s.keyID, &s.wrappedKey)
+		return s, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	batch := &pgx.Batch{}
+	for _, s := range found {
+		if s.keyID != nil && s.wrappedKey != nil {
+			env, err := p.keyring.Rewrap(pii.Envelope{KeyID: *s.keyID, WrappedKey: *s.wrappedKey})
+			if err != nil {
+				return 0, fmt.Errorf("перешифровка доставки заказа %s: %w", s.orderUID, err)
+			}
+			batch.Queue(`UPDATE deliveries SET key_id = $2, wrapped_key = $3 WHERE order_uid = $1`,
+				s.orderUID, env.KeyID, env.WrappedKey)
+			continue
+		}
+
+		row, err := p.sealDelivery(s.orderUID, &s.delivery)
+		if err != nil {
+			return 0, err
+		}
+		queueDeliveryUpdate(batch, s.orderUID, row)
+	}
+	if len(found) == 0 {
+		return 0, nil
+	}
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return 0, err
+	}
+
+	return len(found), tx.Commit(ctx)
+}
+
+// queueDeliveryUpdate добавляет в батч запись персональных полей доставки
+func queueDeliveryUpdate(batch *pgx.Batch, orderUID string, row deliveryRow) {
+	batch.Queue(`UPDATE deliveries SET name = $2, phone = $3, address = $4, email = $5,
+		 key_id = $6, wrapped_key = $7, email_hash = $8, phone_hash = $9 WHERE order_uid = $1`,
+		orderUID, row.Name, row.Phone, row.Address, row.Email,
+		row.KeyID, row.WrappedKey, row.EmailHash, row.PhoneHash)
+}
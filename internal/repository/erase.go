@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"order-service/internal/audit"
+	"order-service/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErasedValue заменяет удаленные персональные данные
+const ErasedValue = "[erased]"
+
+// erasedFields поля с персональными данными в путях журнала изменений
+var erasedFields = []string{
+	"customer_id", "internal_signature",
+	"delivery.name", "delivery.phone", "delivery.address", "delivery.email",
+}
+
+// EraseCustomer обезличивает заказы покупателя: имя, телефон, адрес и email
+// доставки, customer_id и internal_signature заказа. Заказ получает новую версию
+// и отметку erased_at. Персональные данные вычищаются и из журнала изменений,
+// и из неотправленных и хранящихся событий outbox; об обезличивании в журнал
+// пишется отдельная запись. Покупатель запоминается в erased_customers, чтобы
+// его заказы из архива восстанавливались обезличенными. При dryRun ничего не меняется.
+// Возвращает order_uid затронутых заказов.
+func (p *DB) EraseCustomer(ctx context.Context, customerID string, dryRun bool) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, p.bulkTimeout)
+	defer cancel()
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`SELECT order_uid FROM orders WHERE customer_id = $1 ORDER BY date_created FOR UPDATE`, customerID)
+	if err != nil {
+		return nil, err
+	}
+	uids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return uids, nil
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue(`INSERT INTO erased_customers (customer_hash) VALUES ($1) ON CONFLICT DO NOTHING`,
+		customerHash(customerID))
+	if len(uids) > 0 {
+		if err := p.queueErase(ctx, batch, uids); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	p.replicas.wrote(uids...)
+	return uids, nil
+}
+
+// queueErase добавляет в батч обезличивание заказов uids
+func (p *DB) queueErase(ctx context.Context, batch *pgx.Batch, uids []string) error {
+	// Прежние значения в журнал не попадают
+	changes := make(map[string]audit.Change, len(erasedFields))
+	for _, field := range erasedFields {
+		changes[field] = audit.Change{After: ErasedValue}
+	}
+	changes["internal_signature"] = audit.Change{After: ""}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	batch.Queue(`UPDATE deliveries SET name = $2, phone = $2, address = $2, email = $2,
+		key_id = NULL, wrapped_key = NULL, email_hash = NULL, phone_hash = NULL
+		WHERE order_uid = ANY($1)`, uids, ErasedValue)
+	batch.Queue(`UPDATE orders o SET customer_id = $2, internal_signature = '', erased_at = now(), updated_at = now(), version = version + 1`+
+		orderKeysWhere, uids, ErasedValue)
+
+	// Старые записи журнала и события хранят прежние значения. Журнал меняется
+	// только через order_audit_erase: триггер пропускает лишь вычистку персональных данных.
+	batch.Queue(`SELECT order_audit_erase($1)`, uids)
+	batch.Queue(`UPDATE outbox SET payload = jsonb_set(
+			jsonb_set(payload - 'pii_envelope', '{order,delivery}', (payload->'order'->'delivery') ||
+				jsonb_build_object('name', $2::text, 'phone', $2::text, 'address', $2::text, 'email', $2::text)),
+			'{order}', (payload->'order') || jsonb_build_object('customer_id', $2::text, 'internal_signature', ''))
+		WHERE order_uid = ANY($1) AND payload ? 'order'`, uids, ErasedValue)
+
+	for _, orderUID := range uids {
+		source, err := json.Marshal(audit.SourceFor(ctx, orderUID))
+		if err != nil {
+			return err
+		}
+		batch.Queue(insertAuditSQL, orderUID, audit.OpErase, source, changesJSON)
+	}
+	return nil
+}
+
+// customerHash ключ покупателя в erased_customers
+func customerHash(customerID string) string {
+	sum := sha256.Sum256([]byte(customerID))
+	return hex.EncodeToString(sum[:])
+}
+
+// customerErased сообщает, что персональные данные покупателя удалены
+func customerErased(ctx context.Context, tx pgx.Tx, customerID string) (bool, error) {
+	var erased bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM erased_customers WHERE customer_hash = $1)`,
+		customerHash(customerID)).Scan(&erased)
+	return erased, err
+}
+
+// eraseOrder заменяет персональные данные заказа так же, как EraseCustomer
+func eraseOrder(order *models.Order) {
+	order.CustomerID = ErasedValue
+	order.InternalSignature = ""
+	order.Delivery.Name = ErasedValue
+	order.Delivery.Phone = ErasedValue
+	order.Delivery.Address = ErasedValue
+	order.Delivery.Email = ErasedValue
+}
@@ -2,15 +2,25 @@ package repository
 
 import (
 	"context"
+	"time"
 
+	"order-service/internal/audit"
 	"order-service/internal/models"
 )
 
 // OrderRepository интерфейс для работы с заказами в БД
 type OrderRepository interface {
 	SaveOrder(ctx context.Context, order *models.Order) error
+	SaveOrders(ctx context.Context, orders []*models.Order) ([]error, error)
+	UpdateOrder(ctx context.Context, order *models.Order, expectedVersion int64) error
 	GetOrder(ctx context.Context, orderUID string) (*models.Order, error)
 	GetAllOrders(ctx context.Context) (map[string]*models.Order, error)
+	GetOrdersUpdatedSince(ctx context.Context, since time.Time) (map[string]*models.Order, error)
+	// ListOrderUIDs возвращает идентификаторы всех заказов от новых к старым
+	ListOrderUIDs(ctx context.Context) ([]string, error)
+	GetOrderAudit(ctx context.Context, orderUID string) ([]audit.Entry, error)
+	EraseCustomer(ctx context.Context, customerID string, dryRun bool) ([]string, error)
+	FindOrderUIDsByContact(ctx context.Context, email, phone string) ([]string, error)
 	HealthCheck(ctx context.Context) error
 	Close()
 }
@@ -18,8 +28,18 @@ type OrderRepository interface {
 // Cache интерфейс для кэша
 type OrderCache interface {
 	Set(order *models.Order)
+	// SetIfNewer не заменяет закэшированный заказ заказом более старой версии
+	SetIfNewer(order *models.Order) bool
 	Get(orderUID string) (*models.Order, bool)
+	GetWithExpiry(orderUID string) (*models.Order, time.Time, bool)
+	GetEncoded(orderUID string, version int64, view string) (EncodedOrder, bool)
+	SetEncoded(orderUID string, version int64, view string, enc EncodedOrder)
+	Delete(orderUID string)
+	Clear()
+	Keys(limit int) []string
 	GetAll() map[string]*models.Order
 	Restore(orders map[string]*models.Order)
 	Size() int
+	Stats() CacheStats
+	TTL() time.Duration
 }
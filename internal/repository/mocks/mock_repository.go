@@ -7,8 +7,11 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
+	audit "order-service/internal/audit"
 	models "order-service/internal/models"
+	repository "order-service/internal/repository"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -48,6 +51,36 @@ func (mr *MockOrderRepositoryMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockOrderRepository)(nil).Close))
 }
 
+// EraseCustomer mocks base method.
+func (m *MockOrderRepository) EraseCustomer(ctx context.Context, customerID string, dryRun bool) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EraseCustomer", ctx, customerID, dryRun)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EraseCustomer indicates an expected call of EraseCustomer.
+func (mr *MockOrderRepositoryMockRecorder) EraseCustomer(ctx, customerID, dryRun interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EraseCustomer", reflect.TypeOf((*MockOrderRepository)(nil).EraseCustomer), ctx, customerID, dryRun)
+}
+
+// FindOrderUIDsByContact mocks base method.
+func (m *MockOrderRepository) FindOrderUIDsByContact(ctx context.Context, email, phone string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindOrderUIDsByContact", ctx, email, phone)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindOrderUIDsByContact indicates an expected call of FindOrderUIDsByContact.
+func (mr *MockOrderRepositoryMockRecorder) FindOrderUIDsByContact(ctx, email, phone interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOrderUIDsByContact", reflect.TypeOf((*MockOrderRepository)(nil).FindOrderUIDsByContact), ctx, email, phone)
+}
+
 // GetAllOrders mocks base method.
 func (m *MockOrderRepository) GetAllOrders(ctx context.Context) (map[string]*models.Order, error) {
 	m.ctrl.T.Helper()
@@ -78,6 +111,36 @@ func (mr *MockOrderRepositoryMockRecorder) GetOrder(ctx, orderUID interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrder", reflect.TypeOf((*MockOrderRepository)(nil).GetOrder), ctx, orderUID)
 }
 
+// GetOrderAudit mocks base method.
+func (m *MockOrderRepository) GetOrderAudit(ctx context.Context, orderUID string) ([]audit.Entry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrderAudit", ctx, orderUID)
+	ret0, _ := ret[0].([]audit.Entry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrderAudit indicates an expected call of GetOrderAudit.
+func (mr *MockOrderRepositoryMockRecorder) GetOrderAudit(ctx, orderUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderAudit", reflect.TypeOf((*MockOrderRepository)(nil).GetOrderAudit), ctx, orderUID)
+}
+
+// GetOrdersUpdatedSince mocks base method.
+func (m *MockOrderRepository) GetOrdersUpdatedSince(ctx context.Context, since time.Time) (map[string]*models.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrdersUpdatedSince", ctx, since)
+	ret0, _ := ret[0].(map[string]*models.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrdersUpdatedSince indicates an expected call of GetOrdersUpdatedSince.
+func (mr *MockOrderRepositoryMockRecorder) GetOrdersUpdatedSince(ctx, since interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrdersUpdatedSince", reflect.TypeOf((*MockOrderRepository)(nil).GetOrdersUpdatedSince), ctx, since)
+}
+
 // HealthCheck mocks base method.
 func (m *MockOrderRepository) HealthCheck(ctx context.Context) error {
 	m.ctrl.T.Helper()
@@ -92,6 +155,21 @@ func (mr *MockOrderRepositoryMockRecorder) HealthCheck(ctx interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HealthCheck", reflect.TypeOf((*MockOrderRepository)(nil).HealthCheck), ctx)
 }
 
+// ListOrderUIDs mocks base method.
+func (m *MockOrderRepository) ListOrderUIDs(ctx context.Context) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListOrderUIDs", ctx)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListOrderUIDs indicates an expected call of ListOrderUIDs.
+func (mr *MockOrderRepositoryMockRecorder) ListOrderUIDs(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListOrderUIDs", reflect.TypeOf((*MockOrderRepository)(nil).ListOrderUIDs), ctx)
+}
+
 // SaveOrder mocks base method.
 func (m *MockOrderRepository) SaveOrder(ctx context.Context, order *models.Order) error {
 	m.ctrl.T.Helper()
@@ -106,6 +184,35 @@ func (mr *MockOrderRepositoryMockRecorder) SaveOrder(ctx, order interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveOrder", reflect.TypeOf((*MockOrderRepository)(nil).SaveOrder), ctx, order)
 }
 
+// SaveOrders mocks base method.
+func (m *MockOrderRepository) SaveOrders(ctx context.Context, orders []*models.Order) ([]error, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveOrders", ctx, orders)
+	ret0, _ := ret[0].([]error)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SaveOrders indicates an expected call of SaveOrders.
+func (mr *MockOrderRepositoryMockRecorder) SaveOrders(ctx, orders interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveOrders", reflect.TypeOf((*MockOrderRepository)(nil).SaveOrders), ctx, orders)
+}
+
+// UpdateOrder mocks base method.
+func (m *MockOrderRepository) UpdateOrder(ctx context.Context, order *models.Order, expectedVersion int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOrder", ctx, order, expectedVersion)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateOrder indicates an expected call of UpdateOrder.
+func (mr *MockOrderRepositoryMockRecorder) UpdateOrder(ctx, order, expectedVersion interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrder", reflect.TypeOf((*MockOrderRepository)(nil).UpdateOrder), ctx, order, expectedVersion)
+}
+
 // MockOrderCache is a mock of OrderCache interface.
 type MockOrderCache struct {
 	ctrl     *gomock.Controller
@@ -129,6 +236,30 @@ func (m *MockOrderCache) EXPECT() *MockOrderCacheMockRecorder {
 	return m.recorder
 }
 
+// Clear mocks base method.
+func (m *MockOrderCache) Clear() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Clear")
+}
+
+// Clear indicates an expected call of Clear.
+func (mr *MockOrderCacheMockRecorder) Clear() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Clear", reflect.TypeOf((*MockOrderCache)(nil).Clear))
+}
+
+// Delete mocks base method.
+func (m *MockOrderCache) Delete(orderUID string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Delete", orderUID)
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockOrderCacheMockRecorder) Delete(orderUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockOrderCache)(nil).Delete), orderUID)
+}
+
 // Get mocks base method.
 func (m *MockOrderCache) Get(orderUID string) (*models.Order, bool) {
 	m.ctrl.T.Helper()
@@ -158,6 +289,51 @@ func (mr *MockOrderCacheMockRecorder) GetAll() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAll", reflect.TypeOf((*MockOrderCache)(nil).GetAll))
 }
 
+// GetEncoded mocks base method.
+func (m *MockOrderCache) GetEncoded(orderUID string, version int64, view string) (repository.EncodedOrder, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEncoded", orderUID, version, view)
+	ret0, _ := ret[0].(repository.EncodedOrder)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// GetEncoded indicates an expected call of GetEncoded.
+func (mr *MockOrderCacheMockRecorder) GetEncoded(orderUID, version, view interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEncoded", reflect.TypeOf((*MockOrderCache)(nil).GetEncoded), orderUID, version, view)
+}
+
+// GetWithExpiry mocks base method.
+func (m *MockOrderCache) GetWithExpiry(orderUID string) (*models.Order, time.Time, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWithExpiry", orderUID)
+	ret0, _ := ret[0].(*models.Order)
+	ret1, _ := ret[1].(time.Time)
+	ret2, _ := ret[2].(bool)
+	return ret0, ret1, ret2
+}
+
+// GetWithExpiry indicates an expected call of GetWithExpiry.
+func (mr *MockOrderCacheMockRecorder) GetWithExpiry(orderUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithExpiry", reflect.TypeOf((*MockOrderCache)(nil).GetWithExpiry), orderUID)
+}
+
+// Keys mocks base method.
+func (m *MockOrderCache) Keys(limit int) []string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Keys", limit)
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+// Keys indicates an expected call of Keys.
+func (mr *MockOrderCacheMockRecorder) Keys(limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Keys", reflect.TypeOf((*MockOrderCache)(nil).Keys), limit)
+}
+
 // Restore mocks base method.
 func (m *MockOrderCache) Restore(orders map[string]*models.Order) {
 	m.ctrl.T.Helper()
@@ -182,6 +358,32 @@ func (mr *MockOrderCacheMockRecorder) Set(order interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockOrderCache)(nil).Set), order)
 }
 
+// SetEncoded mocks base method.
+func (m *MockOrderCache) SetEncoded(orderUID string, version int64, view string, enc repository.EncodedOrder) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetEncoded", orderUID, version, view, enc)
+}
+
+// SetEncoded indicates an expected call of SetEncoded.
+func (mr *MockOrderCacheMockRecorder) SetEncoded(orderUID, version, view, enc interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetEncoded", reflect.TypeOf((*MockOrderCache)(nil).SetEncoded), orderUID, version, view, enc)
+}
+
+// SetIfNewer mocks base method.
+func (m *MockOrderCache) SetIfNewer(order *models.Order) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetIfNewer", order)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// SetIfNewer indicates an expected call of SetIfNewer.
+func (mr *MockOrderCacheMockRecorder) SetIfNewer(order interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetIfNewer", reflect.TypeOf((*MockOrderCache)(nil).SetIfNewer), order)
+}
+
 // Size mocks base method.
 func (m *MockOrderCache) Size() int {
 	m.ctrl.T.Helper()
@@ -195,3 +397,31 @@ func (mr *MockOrderCacheMockRecorder) Size() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Size", reflect.TypeOf((*MockOrderCache)(nil).Size))
 }
+
+// Stats mocks base method.
+func (m *MockOrderCache) Stats() repository.CacheStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(repository.CacheStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats.
+func (mr *MockOrderCacheMockRecorder) Stats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockOrderCache)(nil).Stats))
+}
+
+// TTL mocks base method.
+func (m *MockOrderCache) TTL() time.Duration {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TTL")
+	ret0, _ := ret[0].(time.Duration)
+	return ret0
+}
+
+// TTL indicates an expected call of TTL.
+func (mr *MockOrderCacheMockRecorder) TTL() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TTL", reflect.TypeOf((*MockOrderCache)(nil).TTL))
+}
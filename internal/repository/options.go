@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"order-service/internal/pii"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Option func(o *options)
+
+type options struct {
+	pool         PoolConfig
+	queryTimeout time.Duration
+	bulkTimeout  time.Duration
+
+	replicaURLs          []string
+	replicaCheckInterval time.Duration
+	readYourWritesWindow time.Duration
+
+	keyring *pii.Keyring
+}
+
+// PoolConfig настройки пула соединений. Нулевые поля не меняют значения
+// из строки подключения (или умолчания pgx).
+type PoolConfig struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	// statement_timeout сессии: сервер прерывает запрос дольше этого срока
+	StatementTimeout time.Duration
+	ApplicationName  string
+}
+
+// WithPoolConfig задает настройки пулов primary, реплик и шардов
+func WithPoolConfig(cfg PoolConfig) Option {
+	return func(o *options) {
+		o.pool = cfg
+	}
+}
+
+// WithQueryTimeouts задает сроки операций: query - чтение и запись одного
+// заказа или пачки, bulk - загрузка списков заказов. 0 - без ограничения.
+// Архивация, перенос шардов и обслуживание секций сроком не ограничиваются.
+func WithQueryTimeouts(query, bulk time.Duration) Option {
+	return func(o *options) {
+		o.queryTimeout = query
+		o.bulkTimeout = bulk
+	}
+}
+
+// WithFieldEncryption включает шифрование имени, телефона, адреса и email
+// доставки ключами из keyring. Строки, записанные без шифрования,
+// читаются как есть, пока их не перешифрует ReencryptDeliveries.
+func WithFieldEncryption(keyring *pii.Keyring) Option {
+	return func(o *options) {
+		o.keyring = keyring
+	}
+}
+
+func newPool(ctx context.Context, connectionString string, pc PoolConfig) (*pgxpool.Pool, error) {
+	cfg, err := poolConfig(connectionString, pc)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgxpool.NewWithConfig(ctx, cfg)
+}
+
+func poolConfig(connectionString string, pc PoolConfig) (*pgxpool.Config, error) {
+	cfg, err := pgxpool.ParseConfig(connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.MaxConns = 10
+	cfg.MinConns = 1
+	if pc.MaxConns > 0 {
+		cfg.MaxConns = pc.MaxConns
+	}
+	if pc.MinConns > 0 {
+		cfg.MinConns = min(pc.MinConns, cfg.MaxConns)
+	}
+	if pc.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = pc.MaxConnLifetime
+	}
+	if pc.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = pc.MaxConnIdleTime
+	}
+	if pc.HealthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = pc.HealthCheckPeriod
+	}
+
+	params := cfg.ConnConfig.RuntimeParams
+	if pc.StatementTimeout > 0 {
+		params["statement_timeout"] = strconv.FormatInt(pc.StatementTimeout.Milliseconds(), 10)
+	}
+	if pc.ApplicationName != "" {
+		params["application_name"] = pc.ApplicationName
+	}
+
+	return cfg, nil
+}
+
+// withTimeout ограничивает ctx сроком d, если он задан
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// relaxedTx начинает транзакцию, в которой statement_timeout сессии заменен
+// на timeout (0 - без ограничения). Нужна долгим чтениям и обслуживанию.
+func relaxedTx(ctx context.Context, q querier, timeout time.Duration) (pgx.Tx, error) {
+	tx, err := q.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `SELECT set_config('statement_timeout', $1, true)`,
+		strconv.FormatInt(timeout.Milliseconds(), 10)); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	return tx, nil
+}
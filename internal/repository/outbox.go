@@ -0,0 +1,288 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"order-service/internal/models"
+	"order-service/internal/pii"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// EventOrderAccepted тип события о сохранении нового заказа
+const EventOrderAccepted = "order.accepted"
+
+// Задержка повторной отправки растет вдвое с каждой попыткой до outboxMaxBackoff
+const (
+	outboxBaseBackoff = time.Second
+	outboxMaxBackoff  = 5 * time.Minute
+)
+
+// OrderAcceptedEvent содержимое события order.accepted
+type OrderAcceptedEvent struct {
+	Event      string        `json:"event"`
+	OrderUID   string        `json:"order_uid"`
+	AcceptedAt time.Time     `json:"accepted_at"`
+	Order      *models.Order `json:"order"`
+	// Envelope задан, если персональные поля доставки в Order зашифрованы
+	Envelope *pii.Envelope `json:"pii_envelope,omitempty"`
+}
+
+// OutboxMessage неотправленное событие из outbox
+type OutboxMessage struct {
+	ID        int64
+	EventType string
+	OrderUID  string
+	Payload   []byte
+	Attempts  int
+}
+
+// queueOutboxEvent добавляет в батч событие order.accepted. Оно пишется
+// в той же транзакции, что и заказ, поэтому для откаченного заказа его нет.
+func (p *DB) queueOutboxEvent(batch *pgx.Batch, order *models.Order) error {
+	accepted := *order
+	accepted.Version = initialVersion
+
+	event := OrderAcceptedEvent{
+		Event:      EventOrderAccepted,
+		OrderUID:   order.OrderUID,
+		AcceptedAt: time.Now().UTC(),
+		Order:      &accepted,
+	}
+	if err := p.sealOutboxEvent(&event); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("событие заказа %s: %w", order.OrderUID, err)
+	}
+
+	batch.Queue(`INSERT INTO outbox (event_type, order_uid, payload) VALUES ($1, $2, $3)`,
+		EventOrderAccepted, order.OrderUID, payload)
+	return nil
+}
+
+// RelayOutbox забирает до limit готовых к отправке событий и передает их в publish.
+// Строки заблокированы (FOR UPDATE SKIP LOCKED) до конца отправки, поэтому
+// несколько ретрансляторов одной бд не отправят событие дважды.
+// publish возвращает ошибку для каждого сообщения (nil - отправлено): отправленные
+// помечаются sent_at, остальные откладываются с растущей задержкой.
+// Возвращает число отправленных событий.
+func (p *DB) RelayOutbox(ctx context.Context, limit int,
+	publish func(ctx context.Context, messages []OutboxMessage) []error) (int, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, event_type, order_uid, payload, attempts
+		FROM outbox
+		WHERE sent_at IS NULL AND next_attempt_at <= now()
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	messages, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (OutboxMessage, error) {
+		var m OutboxMessage
+		err := row.Scan(&m.ID, &m.EventType, &m.OrderUID, &m.Payload, &m.Attempts)
+		return m, err
+	})
+	if err != nil || len(messages) == 0 {
+		return 0, err
+	}
+
+	// В outbox персональные данные зашифрованы, наружу уходит открытое событие.
+	// Событие, которое не удалось расшифровать, откладывается как неотправленное.
+	errs := make([]error, len(messages))
+	ready := make([]OutboxMessage, 0, len(messages))
+	readyIdx := make([]int, 0, len(messages))
+	for i, m := range messages {
+		payload, err := p.openOutboxPayload(m.OrderUID, m.Payload)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		m.Payload = payload
+		ready = append(ready, m)
+		readyIdx = append(readyIdx, i)
+	}
+	if len(ready) > 0 {
+		for j, err := range publish(ctx, ready) {
+			errs[readyIdx[j]] = err
+		}
+	}
+
+	sent := 0
+	batch := &pgx.Batch{}
+	for i, m := range messages {
+		if errs[i] == nil {
+			sent++
+			batch.Queue(`UPDATE outbox SET sent_at = now(), attempts = attempts + 1, last_error = NULL WHERE id = $1`, m.ID)
+			continue
+		}
+
+		batch.Queue(`UPDATE outbox SET attempts = attempts + 1, last_error = $2, next_attempt_at = now() + $3 * interval '1 second' WHERE id = $1`,
+			m.ID, errs[i].Error(), outboxBackoff(m.Attempts+1).Seconds())
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return 0, err
+	}
+
+	return sent, tx.Commit(ctx)
+}
+
+// PurgeOutbox удаляет события, отправленные раньше before
+func (p *DB) PurgeOutbox(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := p.pool.Exec(ctx, `DELETE FROM outbox WHERE sent_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// outboxAAD привязывает шифротекст события к заказу. Он отличается от aad
+// доставки, чтобы поля события нельзя было подставить в deliveries.
+func outboxAAD(orderUID string) string {
+	return "outbox:" + orderUID
+}
+
+// sealOutboxEvent шифрует имя, телефон, адрес и email доставки в событии,
+// если задан keyring. Заказ копируется: исходный остается открытым.
+func (p *DB) sealOutboxEvent(event *OrderAcceptedEvent) error {
+	if p.keyring == nil || event.Order == nil {
+		return nil
+	}
+
+	order := *event.Order
+	d := order.Delivery
+	env, sealed, err := p.keyring.Seal(outboxAAD(event.OrderUID), d.Name, d.Phone, d.Address, d.Email)
+	if err != nil {
+		return fmt.Errorf("шифрование события заказа %s: %w", event.OrderUID, err)
+	}
+	order.Delivery.Name, order.Delivery.Phone, order.Delivery.Address, order.Delivery.Email =
+		sealed[0], sealed[1], sealed[2], sealed[3]
+
+	event.Order = &order
+	event.Envelope = &env
+	return nil
+}
+
+// openOutboxPayload возвращает событие с расшифрованной доставкой.
+// События без pii_envelope хранятся открыто и возвращаются как есть.
+func (p *DB) openOutboxPayload(orderUID string, payload []byte) ([]byte, error) {
+	var event OrderAcceptedEvent
+	if err := json.Unmarshal(payload, &event); err != nil || event.Envelope == nil || event.Order == nil {
+		return payload, nil
+	}
+	if p.keyring == nil {
+		return nil, fmt.Errorf("%w: событие заказа %s зашифровано ключом %q", ErrNoKeyring, orderUID, event.Envelope.KeyID)
+	}
+
+	d := &event.Order.Delivery
+	opened, err := p.keyring.Open(*event.Envelope, outboxAAD(orderUID), d.Name, d.Phone, d.Address, d.Email)
+	if err != nil {
+		return nil, fmt.Errorf("расшифровка события заказа %s: %w", orderUID, err)
+	}
+	d.Name, d.Phone, d.Address, d.Email = opened[0], opened[1], opened[2], opened[3]
+	event.Envelope = nil
+
+	return json.Marshal(event)
+}
+
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxBaseBackoff
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, outboxMaxBackoff)
+}
+
+// ReencryptOutbox переводит события outbox на ключ primary пачками по batchSize
+// строк: открытые события шифруются, у зашифрованных старым ключом
+// перешифровывается только ключ данных. Возвращает число обработанных строк.
+func (p *DB) ReencryptOutbox(ctx context.Context, batchSize int) (int, error) {
+	if p.keyring == nil {
+		return 0, ErrNoKeyring
+	}
+
+	total := 0
+	for {
+		n, err := p.reencryptOutboxBatch(ctx, batchSize)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			return total, nil
+		}
+		log.Printf("Перешифровка событий outbox: обработано %d", total)
+	}
+}
+
+func (p *DB) reencryptOutboxBatch(ctx context.Context, batchSize int) (int, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, order_uid, payload
+		FROM outbox
+		WHERE payload ? 'order' AND payload->'pii_envelope'->>'key_id' IS DISTINCT FROM $1
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`, p.keyring.Primary(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	found, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (OutboxMessage, error) {
+		var m OutboxMessage
+		err := row.Scan(&m.ID, &m.OrderUID, &m.Payload)
+		return m, err
+	})
+	if err != nil || len(found) == 0 {
+		return 0, err
+	}
+
+	batch := &pgx.Batch{}
+	for _, m := range found {
+		var event OrderAcceptedEvent
+		if err := json.Unmarshal(m.Payload, &event); err != nil {
+			return 0, fmt.Errorf("разбор события outbox %d: %w", m.ID, err)
+		}
+
+		if event.Envelope != nil {
+			env, err := p.keyring.Rewrap(*event.Envelope)
+			if err != nil {
+				return 0, fmt.Errorf("перешифровка события заказа %s: %w", m.OrderUID, err)
+			}
+			event.Envelope = &env
+		} else if err := p.sealOutboxEvent(&event); err != nil {
+			return 0, err
+		}
+
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return 0, err
+		}
+		batch.Queue(`UPDATE outbox SET payload = $2 WHERE id = $1`, m.ID, payload)
+	}
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return 0, err
+	}
+
+	return len(found), tx.Commit(ctx)
+}
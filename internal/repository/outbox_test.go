@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"order-service/internal/pii"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, outboxBackoff(1))
+	assert.Equal(t, 2*time.Second, outboxBackoff(2))
+	assert.Equal(t, 8*time.Second, outboxBackoff(4))
+	assert.Equal(t, outboxMaxBackoff, outboxBackoff(20))
+	assert.Equal(t, outboxMaxBackoff, outboxBackoff(1000))
+}
+
+func TestOutboxEventEncryption(t *testing.T) {
+	keyring, err := pii.NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, bytes.Repeat([]byte{9}, 32))
+	require.NoError(t, err)
+	db := &DB{keyring: keyring}
+
+	order := testOrder("test-outbox-pii", 1)
+	event := OrderAcceptedEvent{Event: EventOrderAccepted, OrderUID: order.OrderUID, Order: order}
+	require.NoError(t, db.sealOutboxEvent(&event))
+	assert.Equal(t, "Test Testov", order.Delivery.Name, "исходный заказ не меняется")
+
+	payload, err := json.Marshal(event)
+	require.NoError(t, err)
+	for _, value := range []string{order.Delivery.Name, order.Delivery.Phone, order.Delivery.Address, order.Delivery.Email} {
+		assert.NotContains(t, string(payload), value)
+	}
+
+	opened, err := db.openOutboxPayload(order.OrderUID, payload)
+	require.NoError(t, err)
+	var published OrderAcceptedEvent
+	require.NoError(t, json.Unmarshal(opened, &published))
+	assert.Nil(t, published.Envelope)
+	assert.Equal(t, order.Delivery, published.Order.Delivery)
+
+	// Шифротекст привязан к заказу
+	_, err = db.openOutboxPayload("other-order", payload)
+	assert.Error(t, err)
+
+	// Без keyring зашифрованное событие не отправляется
+	_, err = (&DB{}).openOutboxPayload(order.OrderUID, payload)
+	assert.ErrorIs(t, err, ErrNoKeyring)
+
+	// Открытые события прежнего формата отправляются как есть
+	plain, err := json.Marshal(OrderAcceptedEvent{Event: EventOrderAccepted, OrderUID: order.OrderUID, Order: order})
+	require.NoError(t, err)
+	opened, err = db.openOutboxPayload(order.OrderUID, plain)
+	require.NoError(t, err)
+	assert.Equal(t, plain, opened)
+}
@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"order-service/internal/audit"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Таблицы orders и items секционированы по месяцам date_created (UTC):
+// секция orders_pYYYYMM содержит заказы с 1-го числа месяца до 1-го числа следующего.
+// Заказы вне существующих секций попадают в orders_default / items_default.
+var partitionedTables = []string{"orders", "items"}
+
+const partitionSuffixLayout = "200601"
+
+// partitionLockKey ключ транзакционной advisory-блокировки: инстансы не создают
+// и не убирают секции одновременно
+const partitionLockKey = 7_100_301
+
+// PartitionConfig настройки обслуживания секций
+type PartitionConfig struct {
+	// Период запуска обслуживания
+	Interval time.Duration
+	// Сколько месяцев вперед держать созданными
+	MonthsAhead int
+	// Секции, целиком старше Retention, удаляются. 0 - хранить всегда.
+	Retention time.Duration
+	// Только отсоединить старые секции (для ручной архивации), не удаляя их
+	DetachOnly bool
+}
+
+// RunPartitionMaintenance создает будущие секции и убирает устаревшие
+// сразу и затем каждые cfg.Interval до отмены ctx
+func (p *DB) RunPartitionMaintenance(ctx context.Context, cfg PartitionConfig) {
+	if cfg.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.MaintainPartitions(ctx, cfg); err != nil {
+			log.Printf("Ошибка обслуживания секций: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// MaintainPartitions однократно выполняет обслуживание секций
+func (p *DB) MaintainPartitions(ctx context.Context, cfg PartitionConfig) error {
+	now := time.Now().UTC()
+
+	for i := 0; i <= cfg.MonthsAhead; i++ {
+		if err := p.EnsurePartition(ctx, monthStart(now).AddDate(0, i, 0)); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Retention > 0 {
+		removed, err := p.RemovePartitionsBefore(ctx, now.Add(-cfg.Retention), cfg.DetachOnly)
+		if err != nil {
+			return err
+		}
+		for _, name := range removed {
+			log.Printf("Секция %s старше срока хранения убрана (только detach: %t)", name, cfg.DetachOnly)
+		}
+	}
+
+	return nil
+}
+
+// EnsurePartition создает месячные секции orders и items, содержащие момент month.
+// Если в default-секции уже есть строки этого месяца, они переносятся в новую секцию.
+func (p *DB) EnsurePartition(ctx context.Context, month time.Time) error {
+	from := monthStart(month)
+	to := from.AddDate(0, 1, 0)
+
+	tx, err := p.partitionTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, table := range partitionedTables {
+		name := partitionName(table, from)
+
+		var exists bool
+		if err := tx.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		// Имена и границы формируются из time.Time, поэтому безопасны для подстановки
+		bounds := fmt.Sprintf("FROM ('%s') TO ('%s')", from.Format(time.RFC3339), to.Format(time.RFC3339))
+		stmts := []string{
+			fmt.Sprintf(`CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS)`, name, table),
+			fmt.Sprintf(`WITH moved AS (
+				DELETE FROM %s_default WHERE date_created >= '%s' AND date_created < '%s' RETURNING *
+			) INSERT INTO %s SELECT * FROM moved`,
+				table, from.Format(time.RFC3339), to.Format(time.RFC3339), name),
+			fmt.Sprintf(`ALTER TABLE %s ATTACH PARTITION %s FOR VALUES %s`, table, name, bounds),
+		}
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("создание секции %s: %w", name, err)
+			}
+		}
+
+		log.Printf("Создана секция %s", name)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RemovePartitionsBefore отсоединяет (и, если не detachOnly, удаляет) месячные
+// секции, целиком лежащие раньше cutoff. Доставки и оплаты заказов из удаляемых
+// секций удаляются в той же транзакции. Возвращает имена убранных секций.
+func (p *DB) RemovePartitionsBefore(ctx context.Context, cutoff time.Time, detachOnly bool) ([]string, error) {
+	months, err := p.listPartitionMonths(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, month := range months {
+		if month.AddDate(0, 1, 0).After(cutoff) {
+			continue
+		}
+
+		ok, err := p.removePartition(ctx, month, detachOnly)
+		if err != nil {
+			return removed, err
+		}
+		if ok {
+			removed = append(removed, partitionName("orders", month))
+		}
+	}
+
+	return removed, nil
+}
+
+// removePartition убирает секции месяца. false: другой инстанс уже убрал их.
+func (p *DB) removePartition(ctx context.Context, month time.Time, detachOnly bool) (bool, error) {
+	orders := partitionName("orders", month)
+	items := partitionName("items", month)
+
+	tx, err := p.partitionTx(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var attached bool
+	if err := tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM pg_inherits WHERE inhrelid = to_regclass($1))`, orders).Scan(&attached); err != nil {
+		return false, err
+	}
+	if !attached {
+		return false, nil
+	}
+
+	// Заказы секции пропадают из orders: журнал получает запись об удалении
+	// каждого без полного снимка (он остается в секции или архиве)
+	source, err := json.Marshal(audit.Source{
+		Type:   audit.SourceSystem,
+		Detail: fmt.Sprintf("срок хранения: секция %s убрана (только detach: %t)", orders, detachOnly),
+	})
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(ctx, fmt.Sprintf(
+		`INSERT INTO order_audit (order_uid, operation, source) SELECT order_uid, $1, $2 FROM %s`, orders),
+		audit.OpDelete, source); err != nil {
+		return false, fmt.Errorf("журнал удаления секции %s: %w", orders, err)
+	}
+
+	stmts := []string{
+		fmt.Sprintf(`ALTER TABLE orders DETACH PARTITION %s`, orders),
+		fmt.Sprintf(`ALTER TABLE items DETACH PARTITION %s`, items),
+	}
+	if !detachOnly {
+		stmts = append(stmts,
+			fmt.Sprintf(`DELETE FROM deliveries WHERE order_uid IN (SELECT order_uid FROM %s)`, orders),
+			fmt.Sprintf(`DELETE FROM payments WHERE order_uid IN (SELECT order_uid FROM %s)`, orders),
+			fmt.Sprintf(`DELETE FROM order_keys WHERE order_uid IN (SELECT order_uid FROM %s)`, orders),
+			fmt.Sprintf(`DROP TABLE %s`, items),
+			fmt.Sprintf(`DROP TABLE %s`, orders),
+		)
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return false, fmt.Errorf("удаление секции %s: %w", orders, err)
+		}
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// partitionTx начинает транзакцию обслуживания секций под advisory-блокировкой.
+// Блокировка снимается при завершении транзакции.
+func (p *DB) partitionTx(ctx context.Context) (pgx.Tx, error) {
+	tx, err := relaxedTx(ctx, p.pool, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, partitionLockKey); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+	return tx, nil
+}
+
+// listPartitionMonths возвращает месяцы существующих секций orders по их именам
+func (p *DB) listPartitionMonths(ctx context.Context) ([]time.Time, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class parent ON parent.oid = i.inhparent
+		WHERE parent.relname = 'orders'
+		ORDER BY c.relname`)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+
+	var months []time.Time
+	for _, name := range names {
+		suffix, ok := strings.CutPrefix(name, "orders_p")
+		if !ok {
+			continue // orders_default
+		}
+		month, err := time.Parse(partitionSuffixLayout, suffix)
+		if err != nil {
+			continue
+		}
+		months = append(months, month)
+	}
+
+	return months, nil
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func partitionName(table string, month time.Time) string {
+	return table + "_p" + month.UTC().Format(partitionSuffixLayout)
+}
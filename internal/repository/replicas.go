@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultReplicaCheckInterval = 5 * time.Second
+	defaultReadYourWritesWindow = 5 * time.Second
+)
+
+// querier общая часть пула primary и реплик, нужная запросам чтения
+type querier interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// WithReplicas направляет чтения на реплики по кругу.
+// Пустые строки пропускаются; без реплик все запросы идут в primary.
+func WithReplicas(urls ...string) Option {
+	return func(o *options) {
+		for _, url := range urls {
+			if url != "" {
+				o.replicaURLs = append(o.replicaURLs, url)
+			}
+		}
+	}
+}
+
+// WithReplicaCheckInterval задает период проверки доступности реплик
+func WithReplicaCheckInterval(interval time.Duration) Option {
+	return func(o *options) {
+		if interval > 0 {
+			o.replicaCheckInterval = interval
+		}
+	}
+}
+
+// WithReadYourWrites задает, сколько после записи заказ читается только из primary.
+// Окно покрывает задержку репликации для записей текущего инстанса.
+func WithReadYourWrites(window time.Duration) Option {
+	return func(o *options) {
+		if window > 0 {
+			o.readYourWritesWindow = window
+		}
+	}
+}
+
+type replica struct {
+	pool    *pgxpool.Pool
+	host    string
+	healthy atomic.Bool
+}
+
+// markDown выводит реплику из ротации до следующей успешной проверки
+func (r *replica) markDown(err error) {
+	if r.healthy.Swap(false) {
+		log.Printf("Реплика %s выведена из ротации: %v", r.host, err)
+	}
+}
+
+// replicaSet реплики с круговым выбором и недавние записи для read-your-writes
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+	window   time.Duration
+
+	mu     sync.Mutex
+	writes map[string]time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newReplicaSet(ctx context.Context, o *options) (*replicaSet, error) {
+	set := &replicaSet{
+		window: o.readYourWritesWindow,
+		writes: make(map[string]time.Time),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	for _, url := range o.replicaURLs {
+		pool, err := newPool(ctx, url, o.pool)
+		if err != nil {
+			set.closePools()
+			return nil, err
+		}
+
+		r := &replica{pool: pool, host: pool.Config().ConnConfig.Host}
+		// Недоступная при старте реплика не мешает запуску: ее вернет проверка
+		if err := pool.Ping(ctx); err != nil {
+			log.Printf("Реплика %s недоступна: %v", r.host, err)
+		} else {
+			r.healthy.Store(true)
+		}
+		set.replicas = append(set.replicas, r)
+	}
+
+	go set.run(o.replicaCheckInterval)
+
+	return set, nil
+}
+
+// pick возвращает следующую здоровую реплику или nil, если читать нужно из primary
+func (s *replicaSet) pick(orderUID string) *replica {
+	if s == nil || s.recentlyWritten(orderUID) {
+		return nil
+	}
+
+	start := s.next.Add(1) - 1
+	for i := range uint64(len(s.replicas)) {
+		r := s.replicas[(start+i)%uint64(len(s.replicas))]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// wrote запоминает запись заказов, чтобы ближайшие чтения шли в primary
+func (s *replicaSet) wrote(orderUIDs ...string) {
+	if s == nil {
+		return
+	}
+
+	until := time.Now().Add(s.window)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, orderUID := range orderUIDs {
+		s.writes[orderUID] = until
+	}
+}
+
+func (s *replicaSet) recentlyWritten(orderUID string) bool {
+	if orderUID == "" {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until, ok := s.writes[orderUID]
+	return ok && time.Now().Before(until)
+}
+
+// run периодически проверяет реплики и чистит устаревшие записи
+func (s *replicaSet) run(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		for _, r := range s.replicas {
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			err := r.pool.Ping(ctx)
+			cancel()
+
+			if err != nil {
+				r.markDown(err)
+			} else if !r.healthy.Swap(true) {
+				log.Printf("Реплика %s возвращена в ротацию", r.host)
+			}
+		}
+
+		s.pruneWrites()
+	}
+}
+
+func (s *replicaSet) pruneWrites() {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for orderUID, until := range s.writes {
+		if now.After(until) {
+			delete(s.writes, orderUID)
+		}
+	}
+}
+
+func (s *replicaSet) close() {
+	if s == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.closePools()
+}
+
+func (s *replicaSet) closePools() {
+	for _, r := range s.replicas {
+		r.pool.Close()
+	}
+}
+
+// read выполняет чтение на реплике и повторяет его в primary, если реплика
+// недоступна или еще не получила заказ. orderUID - ключ read-your-writes, может быть пустым.
+func (p *DB) read(ctx context.Context, orderUID string, fn func(q querier) error) error {
+	r := p.replicas.pick(orderUID)
+	if r == nil {
+		return fn(p.pool)
+	}
+
+	err := fn(r.pool)
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return err
+	case errors.Is(err, ErrOrderNotFound), errors.Is(err, ErrIncompleteOrder):
+		// Реплика могла отстать: ответ primary авторитетный
+	default:
+		// Ошибку сервера (например, конфликт с восстановлением) реплика пережила,
+		// остальное считаем проблемой соединения
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) {
+			r.markDown(err)
+		}
+	}
+
+	return fn(p.pool)
+}
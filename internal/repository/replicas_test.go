@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testReplicaSet(healthy ...bool) *replicaSet {
+	set := &replicaSet{window: time.Minute, writes: make(map[string]time.Time)}
+	for i, ok := range healthy {
+		r := &replica{host: string(rune('a' + i))}
+		r.healthy.Store(ok)
+		set.replicas = append(set.replicas, r)
+	}
+	return set
+}
+
+func TestReplicaSet(t *testing.T) {
+	t.Run("round robin skips unhealthy replicas", func(t *testing.T) {
+		set := testReplicaSet(true, false, true)
+
+		var hosts []string
+		for range 4 {
+			hosts = append(hosts, set.pick("order1").host)
+		}
+		assert.Equal(t, []string{"a", "c", "c", "a"}, hosts)
+	})
+
+	t.Run("no healthy replicas", func(t *testing.T) {
+		set := testReplicaSet(false, false)
+		assert.Nil(t, set.pick("order1"))
+	})
+
+	t.Run("read your writes window", func(t *testing.T) {
+		set := testReplicaSet(true)
+		set.wrote("order1")
+
+		assert.Nil(t, set.pick("order1"))
+		assert.NotNil(t, set.pick("order2"))
+		assert.NotNil(t, set.pick(""), "списки не привязаны к заказу")
+
+		set.writes["order1"] = time.Now().Add(-time.Second)
+		assert.NotNil(t, set.pick("order1"))
+
+		set.pruneWrites()
+		assert.Empty(t, set.writes)
+	})
+
+	t.Run("nil set reads from primary", func(t *testing.T) {
+		var set *replicaSet
+		set.wrote("order1")
+		assert.Nil(t, set.pick("order1"))
+	})
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var ErrUnknownShard = errors.New("шард для shardkey не настроен")
+
+// ShardRange отрезок значений shardkey [From, To], хранящийся на шарде Shard.
+// Если задан MovingTo, отрезок переносится с Shard на MovingTo.
+type ShardRange struct {
+	From     int
+	To       int
+	Shard    string
+	MovingTo string
+}
+
+// ShardMap распределение числовых значений shardkey по шардам
+type ShardMap []ShardRange
+
+// ParseShardMap разбирает карту вида "0-4=s1,5-9=s2" (одиночное значение: "7=s3").
+// Отрезок в состоянии переноса задается как "5-9=s1>s2". Отрезки не должны пересекаться.
+func ParseShardMap(spec string) (ShardMap, error) {
+	var m ShardMap
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		keys, shard, ok := strings.Cut(part, "=")
+		if !ok || shard == "" {
+			return nil, fmt.Errorf("карта шардов: ожидается from-to=shard, получено %q", part)
+		}
+
+		from, to, isRange := strings.Cut(keys, "-")
+		if !isRange {
+			to = from
+		}
+		source, target, moving := strings.Cut(shard, ">")
+		r := ShardRange{Shard: strings.TrimSpace(source), MovingTo: strings.TrimSpace(target)}
+		if r.Shard == "" || moving && (r.MovingTo == "" || r.MovingTo == r.Shard) {
+			return nil, fmt.Errorf("карта шардов: ожидается from-to=shard или from-to=source>target, получено %q", part)
+		}
+		var err error
+		if r.From, err = strconv.Atoi(strings.TrimSpace(from)); err != nil {
+			return nil, fmt.Errorf("карта шардов %q: %w", part, err)
+		}
+		if r.To, err = strconv.Atoi(strings.TrimSpace(to)); err != nil {
+			return nil, fmt.Errorf("карта шардов %q: %w", part, err)
+		}
+		if r.From > r.To {
+			return nil, fmt.Errorf("карта шардов %q: начало больше конца", part)
+		}
+
+		m = append(m, r)
+	}
+
+	slices.SortFunc(m, func(a, b ShardRange) int { return a.From - b.From })
+	for i := 1; i < len(m); i++ {
+		if m[i].From <= m[i-1].To {
+			return nil, fmt.Errorf("карта шардов: отрезки %d-%d и %d-%d пересекаются",
+				m[i-1].From, m[i-1].To, m[i].From, m[i].To)
+		}
+	}
+
+	return m, nil
+}
+
+// ShardFor возвращает имя шарда, в который пишется новый заказ с shardkey.
+// Во время переноса это целевой шард: исходный только отдает заказы.
+func (m ShardMap) ShardFor(shardkey string) (string, error) {
+	r, err := m.lookup(shardkey)
+	if err != nil {
+		return "", err
+	}
+	if r.MovingTo != "" {
+		return r.MovingTo, nil
+	}
+	return r.Shard, nil
+}
+
+// ReadShards возвращает шарды, в которых может храниться заказ с shardkey,
+// в порядке опроса. Во время переноса исходный шард остается главным, пока
+// заказ не удален из него после копирования, затем заказ читается из целевого.
+func (m ShardMap) ReadShards(shardkey string) ([]string, error) {
+	r, err := m.lookup(shardkey)
+	if err != nil {
+		return nil, err
+	}
+	if r.MovingTo != "" {
+		return []string{r.Shard, r.MovingTo}, nil
+	}
+	return []string{r.Shard}, nil
+}
+
+// Moving сообщает, что весь отрезок [from, to] переносится с source на target
+func (m ShardMap) Moving(from, to int, source, target string) bool {
+	next := from
+	for _, r := range m {
+		if r.To < next || r.From > next {
+			continue
+		}
+		if r.Shard != source || r.MovingTo != target {
+			return false
+		}
+		if r.To >= to {
+			return true
+		}
+		next = r.To + 1
+	}
+	return false
+}
+
+func (m ShardMap) lookup(shardkey string) (ShardRange, error) {
+	key, err := strconv.Atoi(shardkey)
+	if err != nil {
+		return ShardRange{}, fmt.Errorf("%w: %q", ErrUnknownShard, shardkey)
+	}
+
+	for _, r := range m {
+		if key >= r.From && key <= r.To {
+			return r, nil
+		}
+	}
+
+	return ShardRange{}, fmt.Errorf("%w: %q", ErrUnknownShard, shardkey)
+}
+
+// Shards возвращает имена шардов, упомянутых в карте
+func (m ShardMap) Shards() []string {
+	var names []string
+	for _, r := range m {
+		for _, name := range []string{r.Shard, r.MovingTo} {
+			if name != "" && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,66 @@
+package repository_test
+
+import (
+	"testing"
+
+	"order-service/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardMap(t *testing.T) {
+	t.Run("lookup", func(t *testing.T) {
+		m, err := repository.ParseShardMap("5-9=s2, 0-4=s1,10=s3")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"s1", "s2", "s3"}, m.Shards())
+
+		for shardkey, want := range map[string]string{"0": "s1", "4": "s1", "5": "s2", "9": "s2", "10": "s3"} {
+			shard, err := m.ShardFor(shardkey)
+			require.NoError(t, err)
+			assert.Equal(t, want, shard, shardkey)
+		}
+	})
+
+	t.Run("unknown shardkey", func(t *testing.T) {
+		m, err := repository.ParseShardMap("0-4=s1")
+		require.NoError(t, err)
+
+		for _, shardkey := range []string{"5", "abc", ""} {
+			_, err := m.ShardFor(shardkey)
+			assert.ErrorIs(t, err, repository.ErrUnknownShard, shardkey)
+		}
+	})
+
+	t.Run("moving range", func(t *testing.T) {
+		m, err := repository.ParseShardMap("0-4=s1,5-7=s1>s2,8-9=s1>s2,10=s3")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"s1", "s2", "s3"}, m.Shards())
+
+		// Новые заказы пишутся в целевой шард, читаются сначала из исходного
+		shard, err := m.ShardFor("6")
+		require.NoError(t, err)
+		assert.Equal(t, "s2", shard)
+
+		shards, err := m.ReadShards("6")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"s1", "s2"}, shards)
+
+		shards, err = m.ReadShards("3")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"s1"}, shards)
+
+		assert.True(t, m.Moving(5, 9, "s1", "s2"))
+		assert.True(t, m.Moving(6, 8, "s1", "s2"))
+		assert.False(t, m.Moving(4, 9, "s1", "s2"), "4 не переносится")
+		assert.False(t, m.Moving(5, 10, "s1", "s2"))
+		assert.False(t, m.Moving(5, 9, "s2", "s1"))
+	})
+
+	t.Run("invalid specs", func(t *testing.T) {
+		for _, spec := range []string{"0-4", "a-4=s1", "5-1=s1", "0-5=s1,5-9=s2", "0-4=", "0-4=s1>", "0-4=>s2", "0-4=s1>s1"} {
+			_, err := repository.ParseShardMap(spec)
+			assert.Error(t, err, spec)
+		}
+	})
+}
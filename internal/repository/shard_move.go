@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"order-service/internal/audit"
+	"order-service/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const defaultMoveBatchSize = 500
+
+// MoveShardRange переносит заказы с shardkey в [from, to] из source в target
+// пачками: пачка копируется в target одной транзакцией (с сохранением версий),
+// затем удаляется из source. Повторный запуск после сбоя безопасен: уже
+// скопированные заказы перезаписываются. Возвращает число перенесенных заказов.
+//
+// Порядок переноса: перевести отрезок в карте шардов в перенос ("5-9=s1>s2")
+// и перезапустить инстансы, чтобы новые заказы писались в target, а чтение и
+// обновление шли в source до удаления оттуда заказа; затем запустить перенос
+// и после его завершения переключить карту на target.
+func MoveShardRange(ctx context.Context, source, target *DB, from, to, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = defaultMoveBatchSize
+	}
+
+	moved := 0
+	for {
+		orders, err := source.ordersInShardRange(ctx, from, to, batchSize)
+		if err != nil {
+			return moved, err
+		}
+		if len(orders) == 0 {
+			return moved, nil
+		}
+
+		if err := target.importOrders(ctx, orders); err != nil {
+			return moved, fmt.Errorf("копирование в целевой шард: %w", err)
+		}
+
+		// Заказ, измененный в source после чтения, не удаляется:
+		// следующая итерация скопирует его заново
+		versions := make(map[string]int64, len(orders))
+		for _, order := range orders {
+			versions[order.OrderUID] = order.Version
+		}
+		deleted, err := source.DeleteOrderVersions(ctx, versions)
+		if err != nil {
+			return moved, fmt.Errorf("удаление из исходного шарда: %w", err)
+		}
+
+		moved += len(deleted)
+		log.Printf("Перенос shardkey %d-%d: перенесено %d заказов", from, to, moved)
+	}
+}
+
+// ordersInShardRange читает из primary до limit заказов с числовым shardkey в [from, to].
+// CASE не дает привести к числу нечисловой shardkey.
+func (p *DB) ordersInShardRange(ctx context.Context, from, to, limit int) ([]*models.Order, error) {
+	tx, err := relaxedTx(ctx, p.pool, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, selectOrderSQL+`
+		WHERE CASE WHEN o.shardkey ~ '^-?[0-9]{1,9}$' THEN o.shardkey::int END BETWEEN $1 AND $2
+		ORDER BY o.date_created
+		LIMIT $3`, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []*models.Order
+	for rows.Next() {
+		order, err := p.scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+// importOrders записывает заказы как есть, включая версию, заменяя существующие
+func (p *DB) importOrders(ctx context.Context, orders []*models.Order) error {
+	tx, err := relaxedTx(ctx, p.pool, 0)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	uids := make([]string, len(orders))
+	for i, order := range orders {
+		uids[i] = order.OrderUID
+	}
+
+	batch := &pgx.Batch{}
+	queueOrderDeletes(batch, uids)
+	for _, order := range orders {
+		if err := p.queueOrderImport(ctx, batch, order); err != nil {
+			return err
+		}
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	p.replicas.wrote(uids...)
+	return nil
+}
+
+// RestoreOrder вставляет ранее выгруженный заказ как есть, с его версией и
+// временем изменения. В отличие от SaveOrder событие order.accepted не пишется.
+// Заказ покупателя, обезличенного после выгрузки, восстанавливается обезличенным.
+// Если заказ уже есть в бд, возвращается ошибка.
+func (p *DB) RestoreOrder(ctx context.Context, order *models.Order) error {
+	ctx, cancel := withTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Архив хранит данные, удаленные после выгрузки: в бд они не возвращаются
+	erased, err := customerErased(ctx, tx, order.CustomerID)
+	if err != nil {
+		return err
+	}
+	if erased {
+		order = order.Clone()
+		eraseOrder(order)
+	}
+
+	batch := &pgx.Batch{}
+	if err := p.queueOrderImport(ctx, batch, order); err != nil {
+		return err
+	}
+	if erased {
+		batch.Queue(`UPDATE orders o SET erased_at = now()`+orderKeyWhere, order.OrderUID)
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	if erased {
+		log.Printf("Заказ %s восстановлен обезличенным: данные покупателя удалены", order.OrderUID)
+	}
+	p.replicas.wrote(order.OrderUID)
+	return nil
+}
+
+// queueOrderImport добавляет в батч вставку заказа с сохранением его версии
+// и времени изменения. Заказам из архивов без updated_at выставляется текущее.
+func (p *DB) queueOrderImport(ctx context.Context, batch *pgx.Batch, order *models.Order) error {
+	if order.UpdatedAt.IsZero() {
+		order.UpdatedAt = updateTime()
+	}
+	if err := p.queueOrderInserts(batch, order); err != nil {
+		return err
+	}
+	if order.Version > 0 {
+		batch.Queue(`UPDATE orders SET version = $2 WHERE order_uid = $1 AND date_created = $3`,
+			order.OrderUID, order.Version, order.DateCreated)
+	}
+	return p.queueAudit(ctx, batch, audit.OpInsert, nil, order)
+}
@@ -0,0 +1,401 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"order-service/internal/audit"
+	"order-service/internal/models"
+)
+
+var ErrShardKeyChanged = errors.New("смена shardkey переносит заказ на другой шард")
+
+var _ OrderRepository = (*ShardedDB)(nil)
+
+// ShardedDB распределяет заказы по нескольким бд по shardkey.
+//
+// Запись идет в шард из карты, обновление — в шарды, где по карте может быть
+// заказ с его shardkey. Чтение по order_uid не знает shardkey, поэтому
+// опрашивает все шарды параллельно. Если заказ нашелся на нескольких шардах
+// (во время переноса отрезка), побеждает копия с шарда, который карта для ее
+// shardkey опрашивает первым. Уникальность order_uid между шардами не проверяется.
+type ShardedDB struct {
+	shards   map[string]*DB
+	names    []string
+	shardMap ShardMap
+}
+
+// NewShardedDB проверяет, что каждый шард из карты подключен.
+// Закрытие ShardedDB закрывает все шарды.
+func NewShardedDB(shards map[string]*DB, shardMap ShardMap) (*ShardedDB, error) {
+	for _, name := range shardMap.Shards() {
+		if _, ok := shards[name]; !ok {
+			return nil, fmt.Errorf("шард %q есть в карте, но не подключен", name)
+		}
+	}
+
+	return &ShardedDB{
+		shards:   shards,
+		names:    slices.Sorted(maps.Keys(shards)),
+		shardMap: shardMap,
+	}, nil
+}
+
+// Shards возвращает подключения ко всем шардам (для обслуживания секций и миграций)
+func (s *ShardedDB) Shards() []*DB {
+	dbs := make([]*DB, 0, len(s.names))
+	for _, name := range s.names {
+		dbs = append(dbs, s.shards[name])
+	}
+	return dbs
+}
+
+func (s *ShardedDB) shardFor(order *models.Order) (*DB, error) {
+	name, err := s.shardMap.ShardFor(order.Shardkey)
+	if err != nil {
+		return nil, fmt.Errorf("заказ %s: %w", order.OrderUID, err)
+	}
+	return s.shards[name], nil
+}
+
+// fanOut параллельно вызывает fn для каждого шарда и объединяет ошибки
+func (s *ShardedDB) fanOut(fn func(name string, db *DB) error) error {
+	errs := make([]error, len(s.names))
+
+	var wg sync.WaitGroup
+	for i, name := range s.names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(name, s.shards[name]); err != nil {
+				errs[i] = fmt.Errorf("шард %s: %w", name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func (s *ShardedDB) SaveOrder(ctx context.Context, order *models.Order) error {
+	db, err := s.shardFor(order)
+	if err != nil {
+		return err
+	}
+	return db.SaveOrder(ctx, order)
+}
+
+// SaveOrders делит пачку по шардам; у каждого шарда своя транзакция.
+// Общая ошибка одного шарда попадает в результат каждого его заказа.
+func (s *ShardedDB) SaveOrders(ctx context.Context, orders []*models.Order) ([]error, error) {
+	results := make([]error, len(orders))
+	groups := make(map[string][]int)
+	for i, order := range orders {
+		name, err := s.shardMap.ShardFor(order.Shardkey)
+		if err != nil {
+			results[i] = fmt.Errorf("заказ %s: %w", order.OrderUID, err)
+			continue
+		}
+		groups[name] = append(groups[name], i)
+	}
+
+	var wg sync.WaitGroup
+	for name, indexes := range groups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			batch := make([]*models.Order, len(indexes))
+			for j, i := range indexes {
+				batch[j] = orders[i]
+			}
+
+			errs, err := s.shards[name].SaveOrders(ctx, batch)
+			for j, i := range indexes {
+				if err != nil {
+					results[i] = fmt.Errorf("шард %s: %w", name, err)
+				} else {
+					results[i] = errs[j]
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// UpdateOrder обновляет заказ на шарде, где он хранится. Шарды опрашиваются
+// в порядке карты: во время переноса сначала исходный, затем целевой.
+// Перенос заказа сменой shardkey не поддерживается: для этого есть MoveShardRange.
+func (s *ShardedDB) UpdateOrder(ctx context.Context, order *models.Order, expectedVersion int64) error {
+	names, err := s.shardMap.ReadShards(order.Shardkey)
+	if err != nil {
+		return fmt.Errorf("заказ %s: %w", order.OrderUID, err)
+	}
+
+	for _, name := range names {
+		err = s.shards[name].UpdateOrder(ctx, order, expectedVersion)
+		if !errors.Is(err, ErrOrderNotFound) {
+			return err
+		}
+	}
+
+	// Заказа нет там, где его ищет карта: либо его нет вовсе, либо сменился shardkey
+	if _, locateErr := s.locate(ctx, order.OrderUID); locateErr == nil {
+		return fmt.Errorf("%w: заказ %s", ErrShardKeyChanged, order.OrderUID)
+	}
+	return err
+}
+
+// locate находит шард, на котором хранится заказ
+func (s *ShardedDB) locate(ctx context.Context, orderUID string) (*DB, error) {
+	var mu sync.Mutex
+	var found *DB
+	err := s.fanOut(func(name string, db *DB) error {
+		ctx, cancel := withTimeout(ctx, db.queryTimeout)
+		defer cancel()
+
+		var exists bool
+		if err := db.pool.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM order_keys WHERE order_uid = $1)`, orderUID).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			mu.Lock()
+			found = db
+			mu.Unlock()
+		}
+		return nil
+	})
+	if found != nil {
+		return found, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, orderUID)
+}
+
+// GetOrder опрашивает все шарды и возвращает найденный заказ.
+// Ошибки недоступных шардов возвращаются, только если заказ не найден.
+func (s *ShardedDB) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	found := make([]*models.Order, len(s.names))
+	err := s.fanOut(func(name string, db *DB) error {
+		order, err := db.GetOrder(ctx, orderUID)
+		if errors.Is(err, ErrOrderNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		found[slices.Index(s.names, name)] = order
+		return nil
+	})
+
+	var best *models.Order
+	bestShard := ""
+	for i, order := range found {
+		if order != nil && (best == nil || s.prefer(order, s.names[i], bestShard)) {
+			best, bestShard = order, s.names[i]
+		}
+	}
+	if best != nil {
+		return best, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, orderUID)
+}
+
+func (s *ShardedDB) GetAllOrders(ctx context.Context) (map[string]*models.Order, error) {
+	return s.collect(func(db *DB) (map[string]*models.Order, error) {
+		return db.GetAllOrders(ctx)
+	})
+}
+
+func (s *ShardedDB) GetOrdersUpdatedSince(ctx context.Context, since time.Time) (map[string]*models.Order, error) {
+	return s.collect(func(db *DB) (map[string]*models.Order, error) {
+		return db.GetOrdersUpdatedSince(ctx, since)
+	})
+}
+
+// collect объединяет заказы со всех шардов, копии одного заказа разрешаются через prefer
+func (s *ShardedDB) collect(load func(db *DB) (map[string]*models.Order, error)) (map[string]*models.Order, error) {
+	results := make([]map[string]*models.Order, len(s.names))
+	err := s.fanOut(func(name string, db *DB) error {
+		shardOrders, err := load(db)
+		results[slices.Index(s.names, name)] = shardOrders
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make(map[string]*models.Order)
+	shards := make(map[string]string)
+	for i, shardOrders := range results {
+		for uid, order := range shardOrders {
+			if current, ok := shards[uid]; !ok || s.prefer(order, s.names[i], current) {
+				orders[uid], shards[uid] = order, s.names[i]
+			}
+		}
+	}
+	return orders, nil
+}
+
+// prefer сообщает, что копию заказа с шарда shard следует предпочесть копии
+// с шарда current: выигрывает шард, который карта опрашивает раньше, при
+// равенстве — шард с меньшим именем
+func (s *ShardedDB) prefer(order *models.Order, shard, current string) bool {
+	rank := func(name string) int {
+		names, err := s.shardMap.ReadShards(order.Shardkey)
+		if i := slices.Index(names, name); err == nil && i >= 0 {
+			return i
+		}
+		return len(s.names)
+	}
+
+	if r, c := rank(shard), rank(current); r != c {
+		return r < c
+	}
+	return shard < current
+}
+
+// ListOrderUIDs возвращает идентификаторы со всех шардов от новых к старым
+func (s *ShardedDB) ListOrderUIDs(ctx context.Context) ([]string, error) {
+	lists := make([][]orderKey, len(s.names))
+	err := s.fanOut(func(name string, db *DB) error {
+		keys, err := db.listOrderKeys(ctx)
+		lists[slices.Index(s.names, name)] = keys
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Во время переноса заказ может быть на двух шардах: копии оказываются рядом
+	keys := slices.Concat(lists...)
+	slices.SortFunc(keys, compareOrderKeys)
+	keys = slices.CompactFunc(keys, func(a, b orderKey) bool { return a.OrderUID == b.OrderUID })
+
+	uids := make([]string, len(keys))
+	for i, key := range keys {
+		uids[i] = key.OrderUID
+	}
+	return uids, nil
+}
+
+// GetOrderAudit собирает журнал заказа со всех шардов: после переноса
+// отрезка история заказа остается и на прежнем шарде
+func (s *ShardedDB) GetOrderAudit(ctx context.Context, orderUID string) ([]audit.Entry, error) {
+	var mu sync.Mutex
+	var entries []audit.Entry
+	err := s.fanOut(func(name string, db *DB) error {
+		shardEntries, err := db.GetOrderAudit(ctx, orderUID)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		entries = append(entries, shardEntries...)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortAuditEntries(entries)
+	return entries, nil
+}
+
+// EraseCustomer обезличивает заказы покупателя на всех шардах
+func (s *ShardedDB) EraseCustomer(ctx context.Context, customerID string, dryRun bool) ([]string, error) {
+	lists := make([][]string, len(s.names))
+	err := s.fanOut(func(name string, db *DB) error {
+		uids, err := db.EraseCustomer(ctx, customerID, dryRun)
+		lists[slices.Index(s.names, name)] = uids
+		return err
+	})
+
+	// Шарды обезличиваются независимо: успевшие вернуть заказы попадают в результат и при ошибке
+	return slices.Concat(lists...), err
+}
+
+// FindOrderUIDsByContact ищет заказы по контактам на всех шардах
+func (s *ShardedDB) FindOrderUIDsByContact(ctx context.Context, email, phone string) ([]string, error) {
+	lists := make([][]string, len(s.names))
+	err := s.fanOut(func(name string, db *DB) error {
+		uids, err := db.FindOrderUIDsByContact(ctx, email, phone)
+		lists[slices.Index(s.names, name)] = uids
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.Concat(lists...), nil
+}
+
+// StreamOrdersBefore читает шарды по очереди
+func (s *ShardedDB) StreamOrdersBefore(ctx context.Context, cutoff time.Time, fn func(order *models.Order) error) error {
+	for _, name := range s.names {
+		if err := s.shards[name].StreamOrdersBefore(ctx, cutoff, fn); err != nil {
+			return fmt.Errorf("шард %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// DeleteOrders удаляет заказы на всех шардах, где они есть
+func (s *ShardedDB) DeleteOrders(ctx context.Context, orderUIDs []string) error {
+	return s.fanOut(func(name string, db *DB) error {
+		return db.DeleteOrders(ctx, orderUIDs)
+	})
+}
+
+// DeleteOrderVersions удаляет неизмененные заказы на всех шардах, где они есть
+func (s *ShardedDB) DeleteOrderVersions(ctx context.Context, versions map[string]int64) ([]string, error) {
+	var mu sync.Mutex
+	var deleted []string
+	err := s.fanOut(func(name string, db *DB) error {
+		shardDeleted, err := db.DeleteOrderVersions(ctx, versions)
+		mu.Lock()
+		deleted = append(deleted, shardDeleted...)
+		mu.Unlock()
+		return err
+	})
+
+	return deleted, err
+}
+
+// RestoreOrder вставляет заказ в шард из карты
+func (s *ShardedDB) RestoreOrder(ctx context.Context, order *models.Order) error {
+	db, err := s.shardFor(order)
+	if err != nil {
+		return err
+	}
+	return db.RestoreOrder(ctx, order)
+}
+
+func (s *ShardedDB) HealthCheck(ctx context.Context) error {
+	return s.fanOut(func(name string, db *DB) error {
+		return db.HealthCheck(ctx)
+	})
+}
+
+func (s *ShardedDB) Close() {
+	for _, db := range s.shards {
+		db.Close()
+	}
+}
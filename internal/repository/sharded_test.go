@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"testing"
+
+	"order-service/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedDBPrefer(t *testing.T) {
+	shardMap, err := ParseShardMap("0-4=s2,5-9=s2>s1")
+	require.NoError(t, err)
+	sharded, err := NewShardedDB(map[string]*DB{"s1": nil, "s2": nil, "s3": nil}, shardMap)
+	require.NoError(t, err)
+
+	// Во время переноса побеждает исходный шард, хотя его имя больше
+	moving := &models.Order{Shardkey: "7"}
+	assert.True(t, sharded.prefer(moving, "s2", "s1"))
+	assert.False(t, sharded.prefer(moving, "s1", "s2"))
+
+	// Копия вне карты уступает шарду из карты
+	assert.True(t, sharded.prefer(&models.Order{Shardkey: "1"}, "s2", "s1"))
+	assert.False(t, sharded.prefer(&models.Order{Shardkey: "1"}, "s3", "s2"))
+
+	// Оба шарда вне карты: выигрывает меньшее имя
+	assert.True(t, sharded.prefer(&models.Order{Shardkey: "1"}, "s1", "s3"))
+	assert.True(t, sharded.prefer(&models.Order{Shardkey: "x"}, "s1", "s2"))
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"order-service/internal/models"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Формат файла снапшота:
+//
+//	magic   [4]byte  "OCSN"
+//	version uint16
+//	takenAt int64    unix nano
+//	length  uint64   длина payload
+//	sum     [32]byte sha256 от payload
+//	payload          zstd(gob([]*models.Order))
+const (
+	snapshotMagic   = "OCSN"
+	snapshotVersion = 1
+	snapshotHeader  = 4 + 2 + 8 + 8 + sha256.Size
+)
+
+var ErrSnapshotCorrupted = errors.New("снапшот кэша поврежден")
+
+// CacheSnapshot содержимое кэша на момент TakenAt
+type CacheSnapshot struct {
+	TakenAt time.Time
+	Orders  []*models.Order
+}
+
+// WriteSnapshot атомарно записывает снапшот в файл: сначала во временный, затем rename
+func WriteSnapshot(path string, snapshot *CacheSnapshot) error {
+	var payload bytes.Buffer
+	enc, err := zstd.NewWriter(&payload)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(enc).Encode(snapshot.Orders); err != nil {
+		enc.Close()
+		return fmt.Errorf("кодирование снапшота: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	header := make([]byte, 0, snapshotHeader)
+	header = append(header, snapshotMagic...)
+	header = binary.BigEndian.AppendUint16(header, snapshotVersion)
+	header = binary.BigEndian.AppendUint64(header, uint64(snapshot.TakenAt.UnixNano()))
+	header = binary.BigEndian.AppendUint64(header, uint64(payload.Len()))
+	sum := sha256.Sum256(payload.Bytes())
+	header = append(header, sum[:]...)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(header); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(payload.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadSnapshot читает и проверяет снапшот. Ошибки формата и контрольной суммы
+// оборачивают ErrSnapshotCorrupted.
+func ReadSnapshot(path string) (*CacheSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < snapshotHeader || string(data[:4]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: неверный заголовок", ErrSnapshotCorrupted)
+	}
+	if version := binary.BigEndian.Uint16(data[4:6]); version != snapshotVersion {
+		return nil, fmt.Errorf("%w: неподдерживаемая версия %d", ErrSnapshotCorrupted, version)
+	}
+
+	takenAt := time.Unix(0, int64(binary.BigEndian.Uint64(data[6:14])))
+	length := binary.BigEndian.Uint64(data[14:22])
+	payload := data[snapshotHeader:]
+	if uint64(len(payload)) != length {
+		return nil, fmt.Errorf("%w: ожидалось %d байт, прочитано %d", ErrSnapshotCorrupted, length, len(payload))
+	}
+
+	sum := sha256.Sum256(payload)
+	if !bytes.Equal(sum[:], data[22:snapshotHeader]) {
+		return nil, fmt.Errorf("%w: контрольная сумма не совпадает", ErrSnapshotCorrupted)
+	}
+
+	dec, err := zstd.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+
+	var orders []*models.Order
+	if err := gob.NewDecoder(dec).Decode(&orders); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupted, err)
+	}
+
+	return &CacheSnapshot{TakenAt: takenAt, Orders: orders}, nil
+}
@@ -0,0 +1,72 @@
+package repository_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"order-service/internal/models"
+	"order-service/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cache.snapshot")
+		takenAt := time.Date(2025, 11, 18, 10, 0, 0, 0, time.UTC)
+
+		orders := []*models.Order{
+			{OrderUID: "order1", Items: []models.Item{{ChrtID: 1, Name: "Mascaras"}}},
+			{OrderUID: "order2", Delivery: models.Delivery{Email: "test@gmail.com"}},
+		}
+
+		require.NoError(t, repository.WriteSnapshot(path, &repository.CacheSnapshot{TakenAt: takenAt, Orders: orders}))
+
+		snapshot, err := repository.ReadSnapshot(path)
+		require.NoError(t, err)
+		assert.True(t, takenAt.Equal(snapshot.TakenAt))
+		assert.Equal(t, orders, snapshot.Orders)
+	})
+
+	t.Run("empty cache", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+		require.NoError(t, repository.WriteSnapshot(path, &repository.CacheSnapshot{TakenAt: time.Now()}))
+
+		snapshot, err := repository.ReadSnapshot(path)
+		require.NoError(t, err)
+		assert.Empty(t, snapshot.Orders)
+	})
+
+	t.Run("corrupted payload", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cache.snapshot")
+		require.NoError(t, repository.WriteSnapshot(path, &repository.CacheSnapshot{
+			TakenAt: time.Now(),
+			Orders:  []*models.Order{{OrderUID: "order1"}},
+		}))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		data[len(data)-1] ^= 0xff
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+
+		_, err = repository.ReadSnapshot(path)
+		assert.ErrorIs(t, err, repository.ErrSnapshotCorrupted)
+	})
+
+	t.Run("truncated file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cache.snapshot")
+		require.NoError(t, os.WriteFile(path, []byte("OCSN"), 0o644))
+
+		_, err := repository.ReadSnapshot(path)
+		assert.ErrorIs(t, err, repository.ErrSnapshotCorrupted)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := repository.ReadSnapshot(filepath.Join(t.TempDir(), "missing"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
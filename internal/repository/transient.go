@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// IsTransient сообщает, что операция не выполнена из-за недоступности бд,
+// а не из-за самого заказа, и ее стоит повторить позже.
+// Временными считаются только сбои соединения, таймауты и классы ошибок
+// сервера, связанные с его доступностью. Остальное (нарушение ограничений,
+// ошибки шифрования и сериализации, проверки репозитория) при повторе
+// повторится, поэтому временным не считается.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code[:2] {
+		case "08", // соединение
+			"40", // сериализация, deadlock
+			"53", // нехватка ресурсов
+			"57", // остановка сервера, отмена запроса
+			"58": // системная ошибка
+			return true
+		}
+		return false
+	}
+
+	// Запрос не дошел до сервера, истек срок или оборвалось соединение
+	var netErr net.Error
+	var connectErr *pgconn.ConnectError
+	switch {
+	case pgconn.SafeToRetry(err),
+		pgconn.Timeout(err),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.As(err, &connectErr),
+		errors.As(err, &netErr):
+		return true
+	}
+	return false
+}
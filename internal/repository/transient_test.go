@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"order-service/internal/pii"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTransient(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+	for _, err := range []error{
+		&pgconn.PgError{Code: "57P01"},
+		&pgconn.PgError{Code: "40001"},
+		refused,
+		fmt.Errorf("сохранение заказа: %w", context.DeadlineExceeded),
+	} {
+		assert.True(t, IsTransient(err), "%v", err)
+	}
+
+	// Ошибки самого заказа при повторе повторятся, партиция встанет
+	for _, err := range []error{
+		nil,
+		&pgconn.PgError{Code: "23505"},
+		ErrOrderNotFound,
+		fmt.Errorf("шифрование доставки: %w", pii.ErrDecrypt),
+		fmt.Errorf("%w: keyring не задан", ErrNoKeyring),
+		errors.New("json: unsupported value"),
+		context.Canceled,
+	} {
+		assert.False(t, IsTransient(err), "%v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"order-service/internal/audit"
+	"order-service/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrVersionConflict = errors.New("заказ изменен другим запросом")
+
+// VersionConflictError ожидаемая версия заказа не совпала с текущей в бд.
+// errors.Is(err, ErrVersionConflict) для нее возвращает true.
+type VersionConflictError struct {
+	OrderUID string
+	Expected int64
+	Actual   int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%s: заказ %s, ожидалась версия %d, текущая %d",
+		ErrVersionConflict, e.OrderUID, e.Expected, e.Actual)
+}
+
+func (e *VersionConflictError) Is(target error) bool {
+	return target == ErrVersionConflict
+}
+
+// UpdateOrder перезаписывает заказ целиком, если его текущая версия равна
+// expectedVersion. При успехе order.Version получает новую версию.
+func (p *DB) UpdateOrder(ctx context.Context, order *models.Order, expectedVersion int64) error {
+	ctx, cancel := withTimeout(ctx, p.queryTimeout)
+	defer cancel()
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Прежнее состояние нужно журналу; блокировка строки заказа до конца транзакции
+	before, err := p.scanOrder(tx.QueryRow(ctx, selectOrderSQL+orderKeyWhere+` FOR UPDATE OF o`, order.OrderUID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrOrderNotFound, order.OrderUID)
+	}
+	if err != nil {
+		return err
+	}
+	if before.Version != expectedVersion {
+		return &VersionConflictError{OrderUID: order.OrderUID, Expected: expectedVersion, Actual: before.Version}
+	}
+
+	var version int64
+	var updatedAt time.Time
+	err = tx.QueryRow(ctx,
+		`UPDATE orders SET track_number = $3, entry = $4, locale = $5, internal_signature = $6,
+		 customer_id = $7, delivery_service = $8, shardkey = $9, sm_id = $10, date_created = $11,
+		 oof_shard = $12, version = version + 1, updated_at = now()
+		 WHERE order_uid = $1 AND date_created = $13 AND version = $2
+		 RETURNING version, updated_at`,
+		order.OrderUID, expectedVersion, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
+		order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard,
+		before.DateCreated,
+	).Scan(&version, &updatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p.versionMismatch(ctx, tx, order.OrderUID, expectedVersion)
+	}
+	if err != nil {
+		return err
+	}
+
+	delivery, err := p.sealDelivery(order.OrderUID, &order.Delivery)
+	if err != nil {
+		return err
+	}
+
+	batch := &pgx.Batch{}
+	if !order.DateCreated.Equal(before.DateCreated) {
+		batch.Queue(`UPDATE order_keys SET date_created = $2 WHERE order_uid = $1`, order.OrderUID, order.DateCreated)
+	}
+	batch.Queue(`UPDATE deliveries SET zip = $2, city = $3, region = $4 WHERE order_uid = $1`,
+		order.OrderUID, order.Delivery.Zip, order.Delivery.City, order.Delivery.Region)
+	queueDeliveryUpdate(batch, order.OrderUID, delivery)
+	batch.Queue(`UPDATE payments SET transaction = $2, request_id = $3, currency = $4, provider = $5,
+		 amount = $6, payment_dt = $7, bank = $8, delivery_cost = $9, goods_total = $10, custom_fee = $11
+		 WHERE order_uid = $1`,
+		order.OrderUID, order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency,
+		order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDt, order.Payment.Bank,
+		order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee)
+
+	// Товары не имеют своего ключа, поэтому заменяются целиком
+	batch.Queue(`DELETE FROM items WHERE order_uid = $1 AND date_created = $2`, order.OrderUID, before.DateCreated)
+	for _, item := range order.Items {
+		batch.Queue(insertItemSQL,
+			order.OrderUID, order.DateCreated, item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name,
+			item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status)
+	}
+
+	updated := *order
+	updated.Version = version
+	updated.UpdatedAt = updatedAt
+	if err := p.queueAudit(ctx, batch, audit.OpUpdate, before, &updated); err != nil {
+		return err
+	}
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	p.replicas.wrote(order.OrderUID)
+	order.Version = version
+	order.UpdatedAt = updatedAt
+	return nil
+}
+
+// versionMismatch выясняет, почему UPDATE не нашел строку: заказа нет или версия другая
+func (p *DB) versionMismatch(ctx context.Context, tx pgx.Tx, orderUID string, expected int64) error {
+	var actual int64
+	err := tx.QueryRow(ctx, `SELECT o.version FROM orders o`+orderKeyWhere, orderUID).Scan(&actual)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrOrderNotFound, orderUID)
+	}
+	if err != nil {
+		return err
+	}
+
+	return &VersionConflictError{OrderUID: orderUID, Expected: expected, Actual: actual}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"order-service/internal/repository"
+)
+
+var ErrRewarmInProgress = errors.New("прогрев кэша уже выполняется")
+
+// RewarmProgress состояние фонового прогрева кэша
+type RewarmProgress struct {
+	Running    bool       `json:"running"`
+	Total      int        `json:"total"`
+	Loaded     int        `json:"loaded"`
+	Failed     int        `json:"failed"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// rewarmState защищает прогресс прогрева от одновременного доступа
+type rewarmState struct {
+	mu       sync.Mutex
+	progress RewarmProgress
+}
+
+// CacheStats статистика кэша вместе со счетчиками фонового обновления
+type CacheStats struct {
+	repository.CacheStats
+	RefreshAhead *RefreshStats `json:"refresh_ahead,omitempty"`
+}
+
+func (s *Service) CacheStats() CacheStats {
+	return CacheStats{
+		CacheStats:   s.cache.Stats(),
+		RefreshAhead: s.RefreshStats(),
+	}
+}
+
+// CacheKeys возвращает ключи кэша в порядке от недавно использованных
+func (s *Service) CacheKeys(limit int) []string {
+	return s.cache.Keys(limit)
+}
+
+// EvictOrder убирает заказ из кэша текущего инстанса
+func (s *Service) EvictOrder(orderUID string) {
+	s.cache.Delete(orderUID)
+}
+
+// EvictAll очищает кэш текущего инстанса
+func (s *Service) EvictAll() {
+	s.cache.Clear()
+}
+
+// RewarmProgress возвращает состояние последнего прогрева кэша
+func (s *Service) RewarmProgress() RewarmProgress {
+	s.rewarm.mu.Lock()
+	defer s.rewarm.mu.Unlock()
+	return s.rewarm.progress
+}
+
+// StartRewarm запускает фоновую загрузку в кэш самых новых заказов из бд,
+// сколько помещается в кэш. Кэш не очищается, поэтому во время прогрева
+// продолжает отвечать.
+func (s *Service) StartRewarm() (RewarmProgress, error) {
+	s.rewarm.mu.Lock()
+	defer s.rewarm.mu.Unlock()
+
+	if s.rewarm.progress.Running {
+		return s.rewarm.progress, ErrRewarmInProgress
+	}
+
+	now := time.Now()
+	s.rewarm.progress = RewarmProgress{Running: true, StartedAt: &now}
+
+	go s.rewarmCache(context.Background())
+
+	return s.rewarm.progress, nil
+}
+
+func (s *Service) rewarmCache(ctx context.Context) {
+	uids, err := s.repo.ListOrderUIDs(ctx)
+	if err != nil {
+		s.finishRewarm(err)
+		return
+	}
+
+	// Заказы сверх емкости кэша вытеснили бы загруженные раньше. Загружаем
+	// от старых к новым, чтобы самые новые оказались недавно использованными.
+	uids = uids[:min(len(uids), s.cache.Stats().Capacity)]
+	slices.Reverse(uids)
+
+	s.updateRewarm(func(p *RewarmProgress) { p.Total = len(uids) })
+
+	for _, orderUID := range uids {
+		order, err := s.repo.GetOrder(ctx, orderUID)
+		if err != nil {
+			log.Printf("Прогрев кэша: ошибка загрузки заказа %s: %v", orderUID, err)
+			s.updateRewarm(func(p *RewarmProgress) { p.Failed++ })
+			continue
+		}
+
+		// Заказ мог быть обновлен, пока шел прогрев
+		s.cache.SetIfNewer(order)
+		s.updateRewarm(func(p *RewarmProgress) { p.Loaded++ })
+	}
+
+	s.finishRewarm(nil)
+}
+
+func (s *Service) updateRewarm(update func(p *RewarmProgress)) {
+	s.rewarm.mu.Lock()
+	defer s.rewarm.mu.Unlock()
+	update(&s.rewarm.progress)
+}
+
+func (s *Service) finishRewarm(err error) {
+	s.updateRewarm(func(p *RewarmProgress) {
+		now := time.Now()
+		p.Running = false
+		p.FinishedAt = &now
+		if err != nil {
+			p.Error = err.Error()
+		}
+	})
+
+	progress := s.RewarmProgress()
+	log.Printf("Прогрев кэша завершен: загружено %d из %d, ошибок %d", progress.Loaded, progress.Total, progress.Failed)
+}
@@ -0,0 +1,96 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"order-service/internal/models"
+	"order-service/internal/repository"
+	"order-service/internal/repository/mocks"
+	"order-service/internal/service"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitRewarm ждет завершения прогрева и возвращает его итог
+func waitRewarm(t *testing.T, svc *service.Service) service.RewarmProgress {
+	require.Eventually(t, func() bool { return !svc.RewarmProgress().Running }, time.Second, 5*time.Millisecond)
+	return svc.RewarmProgress()
+}
+
+func TestRewarm(t *testing.T) {
+	t.Run("loads newest orders up to capacity", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		repo := mocks.NewMockOrderRepository(ctrl)
+		repo.EXPECT().GetAllOrders(gomock.Any()).Return(map[string]*models.Order{}, nil)
+		cache := repository.NewCache(3)
+		svc := service.New(repo, cache)
+
+		repo.EXPECT().ListOrderUIDs(gomock.Any()).Return([]string{"new", "mid", "broken", "old"}, nil)
+		// Самый старый заказ не помещается в кэш и не загружается; загрузка от старых к новым
+		gomock.InOrder(
+			repo.EXPECT().GetOrder(gomock.Any(), "broken").Return(nil, errors.New("connection reset")),
+			repo.EXPECT().GetOrder(gomock.Any(), "mid").Return(validOrder("mid"), nil),
+			repo.EXPECT().GetOrder(gomock.Any(), "new").Return(validOrder("new"), nil),
+		)
+
+		_, err := svc.StartRewarm()
+		require.NoError(t, err)
+
+		progress := waitRewarm(t, svc)
+		assert.Equal(t, 3, progress.Total)
+		assert.Equal(t, 2, progress.Loaded)
+		assert.Equal(t, 1, progress.Failed)
+		assert.Empty(t, progress.Error)
+		assert.NotNil(t, progress.FinishedAt)
+
+		assert.Equal(t, []string{"new", "mid"}, cache.Keys(0))
+	})
+
+	t.Run("keeps version updated during rewarm", func(t *testing.T) {
+		repo, cache, svc := newTestService(t)
+
+		stale := validOrder("order1")
+		stale.Version = 1
+		repo.EXPECT().ListOrderUIDs(gomock.Any()).Return([]string{"order1"}, nil)
+		repo.EXPECT().GetOrder(gomock.Any(), "order1").DoAndReturn(func(context.Context, string) (*models.Order, error) {
+			newer := validOrder("order1")
+			newer.Version = 2
+			svc.ApplyOrderChange("order1", newer)
+			return stale, nil
+		})
+
+		_, err := svc.StartRewarm()
+		require.NoError(t, err)
+		assert.Equal(t, 1, waitRewarm(t, svc).Loaded)
+
+		cached, exists := cache.Get("order1")
+		require.True(t, exists)
+		assert.Equal(t, int64(2), cached.Version)
+	})
+
+	t.Run("rejects concurrent rewarm", func(t *testing.T) {
+		repo, _, svc := newTestService(t)
+
+		release := make(chan struct{})
+		repo.EXPECT().ListOrderUIDs(gomock.Any()).DoAndReturn(func(ctx context.Context) ([]string, error) {
+			<-release
+			return nil, errors.New("db is down")
+		})
+
+		started, err := svc.StartRewarm()
+		require.NoError(t, err)
+		assert.True(t, started.Running)
+
+		progress, err := svc.StartRewarm()
+		assert.ErrorIs(t, err, service.ErrRewarmInProgress)
+		assert.True(t, progress.Running)
+
+		close(release)
+		assert.Equal(t, "db is down", waitRewarm(t, svc).Error)
+	})
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+var ErrCustomerIDRequired = errors.New("не задан customer_id")
+
+// ErasureResult итог обезличивания данных покупателя
+type ErasureResult struct {
+	CustomerID string   `json:"customer_id"`
+	DryRun     bool     `json:"dry_run"`
+	Orders     []string `json:"orders"`
+}
+
+// EraseCustomer обезличивает персональные данные в заказах покупателя и убирает
+// эти заказы из кэшей всех инстансов. Снапшот кэша этого инстанса сразу
+// перезаписывается без них; остальные инстансы перезапишут свои по расписанию.
+// При dryRun только возвращает заказы, которые были бы затронуты.
+// Источник изменения для журнала берется из ctx.
+func (s *Service) EraseCustomer(ctx context.Context, customerID string, dryRun bool) (ErasureResult, error) {
+	if customerID == "" {
+		return ErasureResult{}, ErrCustomerIDRequired
+	}
+
+	uids, err := s.repo.EraseCustomer(ctx, customerID, dryRun)
+	result := ErasureResult{CustomerID: customerID, DryRun: dryRun, Orders: uids}
+	if result.Orders == nil {
+		result.Orders = []string{}
+	}
+	if dryRun {
+		return result, err
+	}
+
+	// Часть заказов могла быть обезличена и при ошибке (на других шардах)
+	for _, orderUID := range uids {
+		s.cache.Delete(orderUID)
+		s.notifyEvicted(orderUID)
+	}
+	if len(uids) > 0 {
+		if snapErr := s.SaveCacheSnapshot(); snapErr != nil {
+			log.Printf("Ошибка перезаписи снапшота кэша после обезличивания: %v", snapErr)
+		}
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	log.Printf("Данные покупателя обезличены: заказов %d", len(uids))
+	return result, nil
+}
+
+// notifyEvicted просит другие инстансы убрать заказ из кэша
+func (s *Service) notifyEvicted(orderUID string) {
+	if s.notifier == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.notifier.NotifyOrderEvicted(ctx, orderUID); err != nil {
+		log.Printf("Ошибка рассылки вытеснения заказа %s: %v", orderUID, err)
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// refreshTimeout ограничение на одно обновление записи из бд
+const refreshTimeout = 5 * time.Second
+
+// RefreshStats счетчики фонового обновления записей кэша
+type RefreshStats struct {
+	Scheduled uint64 `json:"scheduled"`
+	Refreshed uint64 `json:"refreshed"`
+	Failed    uint64 `json:"failed"`
+	Dropped   uint64 `json:"dropped"`  // очередь была заполнена
+	Outdated  uint64 `json:"outdated"` // в кэше уже была более новая версия
+}
+
+// refresher обновляет из бд горячие записи кэша, срок жизни которых подходит к концу.
+// Пул воркеров ограничен, одна и та же запись в очереди не дублируется.
+type refresher struct {
+	window   time.Duration
+	queue    chan string
+	inflight sync.Map
+	done     chan struct{}
+	stopOnce sync.Once
+
+	scheduled atomic.Uint64
+	refreshed atomic.Uint64
+	failed    atomic.Uint64
+	dropped   atomic.Uint64
+	outdated  atomic.Uint64
+}
+
+// WithRefreshAhead включает асинхронное обновление записей кэша, до устаревания
+// которых осталось меньше window. Окно должно быть меньше TTL кэша: иначе каждое
+// чтение ставило бы запись в очередь, поэтому такое окно отклоняется.
+func WithRefreshAhead(window time.Duration, workers int) Option {
+	return func(s *Service) {
+		if window <= 0 {
+			return
+		}
+		if ttl := s.cache.TTL(); window >= ttl {
+			log.Printf("Обновление кэша заранее выключено: окно %s должно быть меньше TTL кэша %s", window, ttl)
+			return
+		}
+		if workers <= 0 {
+			workers = 1
+		}
+
+		s.refresher = &refresher{
+			window: window,
+			queue:  make(chan string, workers*16),
+			done:   make(chan struct{}),
+		}
+		for range workers {
+			go s.refreshWorker()
+		}
+	}
+}
+
+// maybeRefresh ставит запись в очередь, если она скоро устареет
+func (s *Service) maybeRefresh(orderUID string, expiresAt time.Time) {
+	r := s.refresher
+	if r == nil || expiresAt.IsZero() || time.Until(expiresAt) > r.window {
+		return
+	}
+
+	if _, loaded := r.inflight.LoadOrStore(orderUID, struct{}{}); loaded {
+		return
+	}
+
+	select {
+	case r.queue <- orderUID:
+		r.scheduled.Add(1)
+	default:
+		// Не блокируем чтение: запись еще валидна, обновим при следующем обращении
+		r.inflight.Delete(orderUID)
+		r.dropped.Add(1)
+	}
+}
+
+func (s *Service) refreshWorker() {
+	r := s.refresher
+	for {
+		select {
+		case <-r.done:
+			return
+		case orderUID := <-r.queue:
+			s.refreshOrder(orderUID)
+			r.inflight.Delete(orderUID)
+		}
+	}
+}
+
+// refreshOrder перечитывает заказ из бд. При ошибке текущее значение
+// остается в кэше до истечения своего срока. Прочитанный заказ не заменяет
+// более новую версию, записанную в кэш, пока шло чтение (например, из UpdateOrder).
+func (s *Service) refreshOrder(orderUID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+
+	order, err := s.repo.GetOrder(ctx, orderUID)
+	if err != nil {
+		s.refresher.failed.Add(1)
+		log.Printf("Ошибка фонового обновления заказа %s в кэше: %v", orderUID, err)
+		return
+	}
+
+	if !s.cache.SetIfNewer(order) {
+		s.refresher.outdated.Add(1)
+		return
+	}
+	s.refresher.refreshed.Add(1)
+}
+
+// RefreshStats возвращает счетчики фонового обновления, nil если оно выключено
+func (s *Service) RefreshStats() *RefreshStats {
+	r := s.refresher
+	if r == nil {
+		return nil
+	}
+
+	return &RefreshStats{
+		Scheduled: r.scheduled.Load(),
+		Refreshed: r.refreshed.Load(),
+		Failed:    r.failed.Load(),
+		Dropped:   r.dropped.Load(),
+		Outdated:  r.outdated.Load(),
+	}
+}
+
+// Close останавливает фоновые воркеры сервиса
+func (s *Service) Close() {
+	if r := s.refresher; r != nil {
+		r.stopOnce.Do(func() { close(r.done) })
+	}
+}
@@ -0,0 +1,127 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"order-service/internal/models"
+	"order-service/internal/repository"
+	"order-service/internal/repository/mocks"
+	"order-service/internal/service"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshAhead(t *testing.T) {
+	const (
+		ttl    = 300 * time.Millisecond
+		window = 200 * time.Millisecond
+	)
+
+	setup := func(t *testing.T) (*mocks.MockOrderRepository, *service.Service) {
+		ctrl := gomock.NewController(t)
+		repo := mocks.NewMockOrderRepository(ctrl)
+		repo.EXPECT().GetAllOrders(gomock.Any()).Return(map[string]*models.Order{}, nil)
+
+		cache := repository.NewCacheWithTTL(10, ttl)
+		svc := service.New(repo, cache, service.WithRefreshAhead(window, 2))
+		t.Cleanup(svc.Close)
+
+		svc.ApplyOrderChange("order1", &models.Order{OrderUID: "order1", TrackNumber: "old"})
+		return repo, svc
+	}
+
+	t.Run("fresh entry is not refreshed", func(t *testing.T) {
+		_, svc := setup(t)
+
+		order, err := svc.GetOrder(context.Background(), "order1")
+		require.NoError(t, err)
+		assert.Equal(t, "old", order.TrackNumber)
+		assert.Equal(t, uint64(0), svc.RefreshStats().Scheduled)
+	})
+
+	t.Run("entry near expiry is refreshed in background", func(t *testing.T) {
+		repo, svc := setup(t)
+		repo.EXPECT().GetOrder(gomock.Any(), "order1").
+			Return(&models.Order{OrderUID: "order1", TrackNumber: "new"}, nil)
+
+		time.Sleep(ttl - window + 20*time.Millisecond)
+
+		// Пока идет обновление, отдается текущее значение
+		order, err := svc.GetOrder(context.Background(), "order1")
+		require.NoError(t, err)
+		assert.Equal(t, "old", order.TrackNumber)
+
+		assert.Eventually(t, func() bool {
+			return svc.RefreshStats().Refreshed == 1
+		}, time.Second, 5*time.Millisecond)
+
+		order, err = svc.GetOrder(context.Background(), "order1")
+		require.NoError(t, err)
+		assert.Equal(t, "new", order.TrackNumber)
+	})
+
+	t.Run("failed refresh keeps valid value", func(t *testing.T) {
+		repo, svc := setup(t)
+		// Запись по-прежнему близка к устареванию, поэтому каждое чтение снова ставит ее в очередь
+		repo.EXPECT().GetOrder(gomock.Any(), "order1").Return(nil, errors.New("db is down")).MinTimes(1)
+
+		time.Sleep(ttl - window + 20*time.Millisecond)
+
+		_, err := svc.GetOrder(context.Background(), "order1")
+		require.NoError(t, err)
+
+		assert.Eventually(t, func() bool {
+			return svc.RefreshStats().Failed >= 1
+		}, time.Second, 5*time.Millisecond)
+
+		order, err := svc.GetOrder(context.Background(), "order1")
+		require.NoError(t, err)
+		assert.Equal(t, "old", order.TrackNumber)
+	})
+
+	t.Run("refresh does not overwrite newer version", func(t *testing.T) {
+		repo, svc := setup(t)
+		read := make(chan struct{})
+		release := make(chan struct{})
+		repo.EXPECT().GetOrder(gomock.Any(), "order1").
+			DoAndReturn(func(context.Context, string) (*models.Order, error) {
+				close(read)
+				<-release
+				return &models.Order{OrderUID: "order1", TrackNumber: "stale"}, nil
+			})
+
+		time.Sleep(ttl - window + 20*time.Millisecond)
+		_, err := svc.GetOrder(context.Background(), "order1")
+		require.NoError(t, err)
+
+		// Пока обновление читает бд, приходит более новая версия
+		<-read
+		svc.ApplyOrderChange("order1", &models.Order{OrderUID: "order1", TrackNumber: "newer", Version: 2})
+		close(release)
+
+		assert.Eventually(t, func() bool {
+			return svc.RefreshStats().Outdated == 1
+		}, time.Second, 5*time.Millisecond)
+
+		order, err := svc.GetOrder(context.Background(), "order1")
+		require.NoError(t, err)
+		assert.Equal(t, "newer", order.TrackNumber)
+	})
+
+	t.Run("window not shorter than ttl is rejected", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		repo := mocks.NewMockOrderRepository(ctrl)
+		repo.EXPECT().GetAllOrders(gomock.Any()).Return(map[string]*models.Order{}, nil).Times(2)
+
+		svc := service.New(repo, repository.NewCacheWithTTL(10, ttl), service.WithRefreshAhead(ttl, 2))
+		assert.Nil(t, svc.RefreshStats())
+
+		svc = service.New(repo, repository.NewCache(10), service.WithRefreshAhead(window, 2))
+		assert.Nil(t, svc.RefreshStats(), "кэш без TTL")
+	})
+}
@@ -3,23 +3,68 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
+	"os"
 	"time"
 
+	"order-service/internal/audit"
 	"order-service/internal/models"
 	"order-service/internal/repository"
 
 	"github.com/go-playground/validator/v10"
 )
 
+// ChangeNotifier рассылает другим инстансам сервиса событие об изменении заказа
+type ChangeNotifier interface {
+	NotifyOrderChanged(ctx context.Context, order *models.Order) error
+	NotifyOrderEvicted(ctx context.Context, orderUID string) error
+}
+
+// snapshotReconcileOverlap запас при догрузке из бд заказов, измененных после снапшота
+const snapshotReconcileOverlap = 5 * time.Minute
+
+// ErrInvalidOrder заказ не прошел валидацию
+var ErrInvalidOrder = errors.New("валидация заказа failed")
+
+// ErrContactRequired для поиска заказов не задан ни email, ни телефон
+var ErrContactRequired = errors.New("не задан email или телефон")
+
 type Service struct {
 	repo     repository.OrderRepository
 	cache    repository.OrderCache
 	validate *validator.Validate
+	notifier ChangeNotifier
+
+	// Файл снапшота кэша, пусто - снапшоты выключены
+	snapshotPath string
+
+	rewarm rewarmState
+
+	// Фоновое обновление горячих записей, nil если выключено
+	refresher *refresher
+}
+
+// Option настраивает необязательные зависимости сервиса
+type Option func(*Service)
+
+// WithChangeNotifier включает рассылку событий об изменении заказов
+func WithChangeNotifier(notifier ChangeNotifier) Option {
+	return func(s *Service) {
+		s.notifier = notifier
+	}
+}
+
+// WithCacheSnapshot включает загрузку кэша из снапшота при старте и его сохранение в path
+func WithCacheSnapshot(path string) Option {
+	return func(s *Service) {
+		s.snapshotPath = path
+	}
 }
 
-func New(repo repository.OrderRepository, cache repository.OrderCache) *Service {
+func New(repo repository.OrderRepository, cache repository.OrderCache, opts ...Option) *Service {
 	validate := validator.New(validator.WithRequiredStructEnabled())
 
 	svc := &Service{
@@ -28,6 +73,10 @@ func New(repo repository.OrderRepository, cache repository.OrderCache) *Service
 		validate: validate,
 	}
 
+	for _, opt := range opts {
+		opt(svc)
+	}
+
 	// Запись в кэш из бд при загрузке
 	svc.restoreCache()
 
@@ -35,12 +84,10 @@ func New(repo repository.OrderRepository, cache repository.OrderCache) *Service
 }
 
 // ProcessOrder обрабатывает заказ из Kafka
-func (s *Service) ProcessOrder(order *models.Order) error {
-	ctx := context.Background()
-
+func (s *Service) ProcessOrder(ctx context.Context, order *models.Order) error {
 	// ВАЛИДАЦИЯ перед сохранением
 	if err := s.validateOrder(order); err != nil {
-		return fmt.Errorf("валидация заказа failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrInvalidOrder, err)
 	}
 
 	// Сохранение в бд
@@ -50,24 +97,133 @@ func (s *Service) ProcessOrder(order *models.Order) error {
 
 	// Обновление кэша
 	s.cache.Set(order)
+	s.notifyChanged(order)
 
 	log.Printf("Заказ %s успешно обработан и сохранен", order.OrderUID)
 	return nil
 }
 
+// UpdateOrder перезаписывает заказ, если его версия в бд равна expectedVersion.
+// При конфликте возвращает ошибку, для которой errors.Is(err, repository.ErrVersionConflict).
+func (s *Service) UpdateOrder(ctx context.Context, order *models.Order, expectedVersion int64) error {
+	if err := s.validateOrder(order); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidOrder, err)
+	}
+
+	if err := s.repo.UpdateOrder(ctx, order, expectedVersion); err != nil {
+		return err
+	}
+
+	s.cache.Set(order)
+	s.notifyChanged(order)
+
+	log.Printf("Заказ %s обновлен до версии %d", order.OrderUID, order.Version)
+	return nil
+}
+
+// ApplyOrderChange применяет к локальному кэшу изменение, пришедшее от другого инстанса.
+// Если order == nil, запись вытесняется из кэша. Запоздавшее событие не
+// затирает более новую версию, записанную локально.
+func (s *Service) ApplyOrderChange(orderUID string, order *models.Order) {
+	if order == nil {
+		s.cache.Delete(orderUID)
+		return
+	}
+
+	s.cache.SetIfNewer(order)
+}
+
+// notifyChanged сообщает другим инстансам об изменении заказа.
+// Ошибка рассылки не отменяет уже сохраненный заказ, поэтому только логируется.
+func (s *Service) notifyChanged(order *models.Order) {
+	if s.notifier == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.notifier.NotifyOrderChanged(ctx, order); err != nil {
+		log.Printf("Ошибка рассылки изменения заказа %s: %v", order.OrderUID, err)
+	}
+}
+
+// ProcessOrders обрабатывает пачку заказов из Kafka одной транзакцией.
+// Возвращает ошибки по индексам orders, nil - заказ сохранен.
+func (s *Service) ProcessOrders(ctx context.Context, orders []*models.Order) []error {
+	results := make([]error, len(orders))
+
+	// Валидные заказы и их индексы в исходном срезе
+	valid := make([]*models.Order, 0, len(orders))
+	indexes := make([]int, 0, len(orders))
+	for i, order := range orders {
+		if err := s.validateOrder(order); err != nil {
+			results[i] = fmt.Errorf("%w: %w", ErrInvalidOrder, err)
+			continue
+		}
+		valid = append(valid, order)
+		indexes = append(indexes, i)
+	}
+
+	saveErrs, err := s.repo.SaveOrders(ctx, valid)
+	if err != nil {
+		for _, i := range indexes {
+			results[i] = err
+		}
+		return results
+	}
+
+	for j, order := range valid {
+		if saveErrs[j] != nil {
+			results[indexes[j]] = saveErrs[j]
+			continue
+		}
+
+		s.cache.Set(order)
+		s.notifyChanged(order)
+	}
+
+	log.Printf("Пачка заказов обработана: %d из %d сохранено", len(valid)-countErrors(saveErrs), len(orders))
+	return results
+}
+
+func countErrors(errs []error) int {
+	n := 0
+	for _, err := range errs {
+		if err != nil {
+			n++
+		}
+	}
+	return n
+}
+
 // ProcessOrderFromJSON обрабатывает сырые JSON данные из Kafka
-func (s *Service) ProcessOrderFromJSON(data []byte) error {
+func (s *Service) ProcessOrderFromJSON(ctx context.Context, data []byte) error {
 	var order models.Order
 	if err := json.Unmarshal(data, &order); err != nil {
 		return fmt.Errorf("ошибка парсинга JSON: %w", err)
 	}
 
-	return s.ProcessOrder(&order)
+	return s.ProcessOrder(ctx, &order)
+}
+
+// OrderAudit возвращает журнал изменений заказа
+func (s *Service) OrderAudit(ctx context.Context, orderUID string) ([]audit.Entry, error) {
+	return s.repo.GetOrderAudit(ctx, orderUID)
+}
+
+// FindOrders возвращает order_uid заказов с указанными email и/или телефоном доставки
+func (s *Service) FindOrders(ctx context.Context, email, phone string) ([]string, error) {
+	if email == "" && phone == "" {
+		return nil, ErrContactRequired
+	}
+	return s.repo.FindOrderUIDsByContact(ctx, email, phone)
 }
 
 func (s *Service) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
 	// Взять из кэша (быстрая операция - не нужен context)
-	if order, exists := s.cache.Get(orderUID); exists {
+	if order, expiresAt, exists := s.cache.GetWithExpiry(orderUID); exists {
+		s.maybeRefresh(orderUID, expiresAt)
 		return order, nil
 	}
 
@@ -77,11 +233,40 @@ func (s *Service) GetOrder(ctx context.Context, orderUID string) (*models.Order,
 		return nil, err
 	}
 
-	s.cache.Set(order)
+	// Отставшая реплика могла вернуть версию старше той, что пока шло
+	// чтение пришла через синхронизацию кэшей или UpdateOrder
+	s.cache.SetIfNewer(order)
 	return order, nil
 }
 
+// GetOrderEncoded возвращает заказ вместе с его сериализованным представлением view.
+// Представление берется из кэша, если оно посчитано для той же версии заказа,
+// иначе строится через encode и сохраняется рядом с заказом.
+func (s *Service) GetOrderEncoded(ctx context.Context, orderUID, view string,
+	encode func(*models.Order) (repository.EncodedOrder, error)) (*models.Order, repository.EncodedOrder, error) {
+	order, err := s.GetOrder(ctx, orderUID)
+	if err != nil {
+		return nil, repository.EncodedOrder{}, err
+	}
+
+	if enc, ok := s.cache.GetEncoded(orderUID, order.Version, view); ok {
+		return order, enc, nil
+	}
+
+	enc, err := encode(order)
+	if err != nil {
+		return nil, repository.EncodedOrder{}, err
+	}
+	s.cache.SetEncoded(orderUID, order.Version, view, enc)
+
+	return order, enc, nil
+}
+
 func (s *Service) restoreCache() {
+	if s.snapshotPath != "" && s.restoreCacheFromSnapshot() {
+		return
+	}
+
 	ctx := context.Background()
 	log.Println("Получение кэша из базы данных...")
 
@@ -95,6 +280,103 @@ func (s *Service) restoreCache() {
 	log.Printf("Кэш загружен, записей: %d", len(orders))
 }
 
+// restoreCacheFromSnapshot загружает кэш из снапшота, отбрасывает заказы, которых
+// больше нет в бд, и догружает из бд заказы, созданные или измененные после него.
+// Возвращает false, если нужно восстанавливаться из бд целиком.
+func (s *Service) restoreCacheFromSnapshot() bool {
+	snapshot, err := repository.ReadSnapshot(s.snapshotPath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Ошибка чтения снапшота кэша %s: %v", s.snapshotPath, err)
+		}
+		return false
+	}
+
+	ctx := context.Background()
+
+	// Заказы, удаленные или перенесенные в архив после снапшота, в кэш не попадают
+	uids, err := s.repo.ListOrderUIDs(ctx)
+	if err != nil {
+		log.Printf("Ошибка сверки снапшота кэша с бд: %v", err)
+		return false
+	}
+	existing := make(map[string]struct{}, len(uids))
+	for _, uid := range uids {
+		existing[uid] = struct{}{}
+	}
+
+	orders := make(map[string]*models.Order, len(snapshot.Orders))
+	dropped := 0
+	for _, order := range snapshot.Orders {
+		if _, ok := existing[order.OrderUID]; !ok {
+			dropped++
+			continue
+		}
+		orders[order.OrderUID] = order
+	}
+
+	// Созданные и измененные после снапшота (в том числе обезличенные) заказы
+	// догружаются из бд. updated_at новых заказов ставят часы записавшего их
+	// инстанса, измененных - часы бд, а TakenAt - часы этого инстанса,
+	// поэтому берем запас по времени.
+	since := snapshot.TakenAt.Add(-snapshotReconcileOverlap)
+	newer, err := s.repo.GetOrdersUpdatedSince(ctx, since)
+	if err != nil {
+		log.Printf("Ошибка сверки снапшота кэша с бд: %v", err)
+		return false
+	}
+	maps.Copy(orders, newer)
+	s.cache.Restore(orders)
+
+	log.Printf("Кэш загружен из снапшота от %s, записей: %d, удалено из бд: %d, догружено из бд: %d",
+		snapshot.TakenAt.Format(time.RFC3339), s.cache.Size(), dropped, len(newer))
+	return true
+}
+
+// SaveCacheSnapshot сохраняет текущее содержимое кэша в файл снапшота
+func (s *Service) SaveCacheSnapshot() error {
+	if s.snapshotPath == "" {
+		return nil
+	}
+
+	all := s.cache.GetAll()
+	snapshot := &repository.CacheSnapshot{
+		TakenAt: time.Now(),
+		Orders:  make([]*models.Order, 0, len(all)),
+	}
+	for _, order := range all {
+		snapshot.Orders = append(snapshot.Orders, order)
+	}
+
+	if err := repository.WriteSnapshot(s.snapshotPath, snapshot); err != nil {
+		return fmt.Errorf("запись снапшота кэша: %w", err)
+	}
+
+	log.Printf("Снапшот кэша сохранен, записей: %d", len(snapshot.Orders))
+	return nil
+}
+
+// RunCacheSnapshots периодически сохраняет снапшот кэша до отмены ctx
+func (s *Service) RunCacheSnapshots(ctx context.Context, interval time.Duration) {
+	if s.snapshotPath == "" || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.SaveCacheSnapshot(); err != nil {
+				log.Printf("Ошибка сохранения снапшота кэша: %v", err)
+			}
+		}
+	}
+}
+
 func (s *Service) HealthCheck(ctx context.Context) error {
 	return s.repo.HealthCheck(ctx) // Передаем context в репозиторий
 }
@@ -0,0 +1,322 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"order-service/internal/models"
+	"order-service/internal/repository"
+	"order-service/internal/repository/mocks"
+	"order-service/internal/service"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validOrder возвращает заказ, проходящий валидацию
+func validOrder(orderUID string) *models.Order {
+	return &models.Order{
+		OrderUID:    orderUID,
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction: orderUID, Currency: "USD", Provider: "wbpay", Amount: 1817,
+			PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317,
+		},
+		Items: []models.Item{{
+			ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, Rid: "ab4219087a764ae0btest",
+			Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: 317, NmID: 2389212,
+			Brand: "Vivienne Sabo", Status: 202,
+		}},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		Shardkey:        "9",
+		SmID:            99,
+		DateCreated:     time.Now(),
+		OofShard:        "1",
+	}
+}
+
+func newTestService(t *testing.T) (*mocks.MockOrderRepository, *repository.LRUCache, *service.Service) {
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockOrderRepository(ctrl)
+	repo.EXPECT().GetAllOrders(gomock.Any()).Return(map[string]*models.Order{}, nil)
+
+	cache := repository.NewCache(10)
+	return repo, cache, service.New(repo, cache)
+}
+
+func TestProcessOrders(t *testing.T) {
+	t.Run("per-order results", func(t *testing.T) {
+		repo, cache, svc := newTestService(t)
+
+		ok := validOrder("ok")
+		invalid := validOrder("invalid")
+		invalid.Payment.GoodsTotal = 1 // не совпадает с суммой товаров
+		duplicate := validOrder("duplicate")
+
+		duplicateErr := errors.New("duplicate key")
+		repo.EXPECT().SaveOrders(gomock.Any(), []*models.Order{ok, duplicate}).
+			Return([]error{nil, duplicateErr}, nil)
+
+		results := svc.ProcessOrders(context.Background(), []*models.Order{ok, invalid, duplicate})
+		require.Len(t, results, 3)
+		assert.NoError(t, results[0])
+		assert.ErrorContains(t, results[1], "несоответствие сумм")
+		assert.ErrorIs(t, results[2], duplicateErr)
+
+		_, cached := cache.Get("ok")
+		assert.True(t, cached)
+		_, cached = cache.Get("duplicate")
+		assert.False(t, cached)
+	})
+
+	t.Run("transaction failure fails every valid order", func(t *testing.T) {
+		repo, cache, svc := newTestService(t)
+
+		txErr := errors.New("connection reset")
+		repo.EXPECT().SaveOrders(gomock.Any(), gomock.Any()).Return(nil, txErr)
+
+		results := svc.ProcessOrders(context.Background(), []*models.Order{validOrder("a"), validOrder("b")})
+		assert.ErrorIs(t, results[0], txErr)
+		assert.ErrorIs(t, results[1], txErr)
+		assert.Equal(t, 0, cache.Size())
+	})
+}
+
+func TestUpdateOrder(t *testing.T) {
+	t.Run("success updates cache with new version", func(t *testing.T) {
+		repo, cache, svc := newTestService(t)
+
+		order := validOrder("order1")
+		repo.EXPECT().UpdateOrder(gomock.Any(), order, int64(1)).
+			DoAndReturn(func(_ context.Context, o *models.Order, _ int64) error {
+				o.Version = 2
+				return nil
+			})
+
+		require.NoError(t, svc.UpdateOrder(context.Background(), order, 1))
+
+		cached, exists := cache.Get("order1")
+		require.True(t, exists)
+		assert.Equal(t, int64(2), cached.Version)
+	})
+
+	t.Run("version conflict leaves cache untouched", func(t *testing.T) {
+		repo, cache, svc := newTestService(t)
+
+		repo.EXPECT().UpdateOrder(gomock.Any(), gomock.Any(), int64(1)).
+			Return(&repository.VersionConflictError{OrderUID: "order1", Expected: 1, Actual: 3})
+
+		err := svc.UpdateOrder(context.Background(), validOrder("order1"), 1)
+		assert.ErrorIs(t, err, repository.ErrVersionConflict)
+
+		var conflict *repository.VersionConflictError
+		require.ErrorAs(t, err, &conflict)
+		assert.Equal(t, int64(3), conflict.Actual)
+		assert.Equal(t, 0, cache.Size())
+	})
+
+	t.Run("invalid order is rejected before repository", func(t *testing.T) {
+		_, _, svc := newTestService(t)
+
+		order := validOrder("order1")
+		order.Delivery.Email = "not-an-email"
+
+		err := svc.UpdateOrder(context.Background(), order, 1)
+		assert.ErrorIs(t, err, service.ErrInvalidOrder)
+	})
+}
+
+func TestApplyOrderChange(t *testing.T) {
+	_, cache, svc := newTestService(t)
+
+	svc.ApplyOrderChange("order1", &models.Order{OrderUID: "order1", TrackNumber: "new", Version: 3})
+
+	// Событие о предыдущей версии пришло позже
+	svc.ApplyOrderChange("order1", &models.Order{OrderUID: "order1", TrackNumber: "old", Version: 2})
+	cached, exists := cache.Get("order1")
+	require.True(t, exists)
+	assert.Equal(t, "new", cached.TrackNumber)
+
+	svc.ApplyOrderChange("order1", nil)
+	assert.Equal(t, 0, cache.Size())
+}
+
+func TestGetOrder(t *testing.T) {
+	t.Run("stale read does not overwrite newer cached version", func(t *testing.T) {
+		repo, cache, svc := newTestService(t)
+
+		repo.EXPECT().GetOrder(gomock.Any(), "order1").
+			DoAndReturn(func(context.Context, string) (*models.Order, error) {
+				// Пока идет чтение, другой инстанс обновляет заказ
+				svc.ApplyOrderChange("order1", &models.Order{OrderUID: "order1", TrackNumber: "new", Version: 3})
+				return &models.Order{OrderUID: "order1", TrackNumber: "old", Version: 2}, nil
+			})
+
+		_, err := svc.GetOrder(context.Background(), "order1")
+		require.NoError(t, err)
+
+		cached, exists := cache.Get("order1")
+		require.True(t, exists)
+		assert.Equal(t, "new", cached.TrackNumber)
+	})
+}
+
+func TestEraseCustomer(t *testing.T) {
+	t.Run("empty customer id", func(t *testing.T) {
+		_, _, svc := newTestService(t)
+
+		_, err := svc.EraseCustomer(context.Background(), "", false)
+		assert.ErrorIs(t, err, service.ErrCustomerIDRequired)
+	})
+
+	t.Run("erasure evicts orders from cache", func(t *testing.T) {
+		repo, cache, svc := newTestService(t)
+		cache.Set(validOrder("order1"))
+		cache.Set(validOrder("order2"))
+
+		repo.EXPECT().EraseCustomer(gomock.Any(), "test", false).Return([]string{"order1"}, nil)
+
+		result, err := svc.EraseCustomer(context.Background(), "test", false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"order1"}, result.Orders)
+
+		_, exists := cache.Get("order1")
+		assert.False(t, exists)
+		_, exists = cache.Get("order2")
+		assert.True(t, exists)
+	})
+
+	t.Run("erasure rewrites cache snapshot", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cache.snapshot")
+		ctrl := gomock.NewController(t)
+		repo := mocks.NewMockOrderRepository(ctrl)
+		repo.EXPECT().GetAllOrders(gomock.Any()).Return(map[string]*models.Order{
+			"order1": validOrder("order1"), "order2": validOrder("order2"),
+		}, nil)
+		svc := service.New(repo, repository.NewCache(10), service.WithCacheSnapshot(path))
+		require.NoError(t, svc.SaveCacheSnapshot())
+
+		repo.EXPECT().EraseCustomer(gomock.Any(), "test", false).Return([]string{"order1"}, nil)
+		_, err := svc.EraseCustomer(context.Background(), "test", false)
+		require.NoError(t, err)
+
+		snapshot, err := repository.ReadSnapshot(path)
+		require.NoError(t, err)
+		require.Len(t, snapshot.Orders, 1)
+		assert.Equal(t, "order2", snapshot.Orders[0].OrderUID)
+	})
+
+	t.Run("dry run keeps cache", func(t *testing.T) {
+		repo, cache, svc := newTestService(t)
+		cache.Set(validOrder("order1"))
+
+		repo.EXPECT().EraseCustomer(gomock.Any(), "test", true).Return([]string{"order1"}, nil)
+
+		result, err := svc.EraseCustomer(context.Background(), "test", true)
+		require.NoError(t, err)
+		assert.True(t, result.DryRun)
+		assert.Equal(t, []string{"order1"}, result.Orders)
+
+		_, exists := cache.Get("order1")
+		assert.True(t, exists)
+	})
+}
+
+func TestFindOrders(t *testing.T) {
+	t.Run("contact required", func(t *testing.T) {
+		_, _, svc := newTestService(t)
+
+		_, err := svc.FindOrders(context.Background(), "", "")
+		assert.ErrorIs(t, err, service.ErrContactRequired)
+	})
+
+	t.Run("lookup by email", func(t *testing.T) {
+		repo, _, svc := newTestService(t)
+		repo.EXPECT().FindOrderUIDsByContact(gomock.Any(), "test@gmail.com", "").Return([]string{"order1"}, nil)
+
+		uids, err := svc.FindOrders(context.Background(), "test@gmail.com", "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"order1"}, uids)
+	})
+}
+
+func TestGetOrderEncoded(t *testing.T) {
+	_, cache, svc := newTestService(t)
+	order := validOrder("order1")
+	order.Version = 1
+	cache.Set(order)
+
+	calls := 0
+	encode := func(order *models.Order) (repository.EncodedOrder, error) {
+		calls++
+		return repository.EncodedOrder{Data: []byte(order.OrderUID), Hash: "h"}, nil
+	}
+
+	for range 2 {
+		got, enc, err := svc.GetOrderEncoded(context.Background(), "order1", "admin", encode)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), got.Version)
+		assert.Equal(t, []byte("order1"), enc.Data)
+	}
+	assert.Equal(t, 1, calls, "повторный запрос берет тело из кэша")
+
+	// После изменения заказа тело строится заново
+	order.Version = 2
+	cache.Set(order)
+	_, _, err := svc.GetOrderEncoded(context.Background(), "order1", "admin", encode)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestRestoreCacheFromSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	takenAt := time.Now().Add(-time.Hour)
+
+	stale := validOrder("stale")
+	stale.Version = 1
+	archived := validOrder("archived")
+	unchanged := validOrder("unchanged")
+	require.NoError(t, repository.WriteSnapshot(path, &repository.CacheSnapshot{
+		TakenAt: takenAt,
+		Orders:  []*models.Order{stale, archived, unchanged},
+	}))
+
+	updated := validOrder("stale")
+	updated.Version = 2
+	created := validOrder("created")
+
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockOrderRepository(ctrl)
+	repo.EXPECT().ListOrderUIDs(gomock.Any()).Return([]string{"stale", "unchanged", "created"}, nil)
+	repo.EXPECT().GetOrdersUpdatedSince(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, since time.Time) (map[string]*models.Order, error) {
+			assert.True(t, since.Before(takenAt))
+			return map[string]*models.Order{"stale": updated, "created": created}, nil
+		})
+
+	cache := repository.NewCache(10)
+	service.New(repo, cache, service.WithCacheSnapshot(path))
+
+	got, ok := cache.Get("stale")
+	require.True(t, ok)
+	assert.Equal(t, int64(2), got.Version)
+
+	_, ok = cache.Get("archived")
+	assert.False(t, ok, "заказа больше нет в бд")
+
+	for _, uid := range []string{"unchanged", "created"} {
+		_, ok = cache.Get(uid)
+		assert.True(t, ok, uid)
+	}
+}
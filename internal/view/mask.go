@@ -0,0 +1,65 @@
+package view
+
+import (
+	"strings"
+)
+
+// maskRune заменяет скрытые символы
+const maskRune = '*'
+
+// MaskPhone оставляет первые 4 и последние 2 символа: +9720000000 -> +972*****00
+func MaskPhone(phone string) string {
+	return maskMiddle(phone, 4, 2)
+}
+
+// MaskEmail оставляет первый символ имени и домен: test@gmail.com -> t***@gmail.com
+func MaskEmail(email string) string {
+	at := strings.LastIndexByte(email, '@')
+	if at <= 0 {
+		return maskMiddle(email, 0, 0)
+	}
+
+	first := []rune(email[:at])[0]
+	return string(first) + "***" + email[at:]
+}
+
+// MaskName оставляет первую букву каждого слова: Test Testov -> T*** T*****
+func MaskName(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		words[i] = maskMiddle(word, 1, 0)
+	}
+	return strings.Join(words, " ")
+}
+
+// Truncate оставляет первые n символов: b563feb7b2b84b6test -> b563feb7…
+func Truncate(value string, n int) string {
+	runes := []rune(value)
+	if len(runes) <= n {
+		return value
+	}
+	return string(runes[:n]) + "…"
+}
+
+// Hide скрывает значение целиком, сохраняя признак того, что оно было
+func Hide(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "***"
+}
+
+// maskMiddle заменяет все символы, кроме head первых и tail последних.
+// Если скрытыми остались бы меньше трех символов, открыто не больше половины
+// символов и только в начале.
+func maskMiddle(value string, head, tail int) string {
+	runes := []rune(value)
+	if len(runes)-head-tail < 3 {
+		head, tail = min(head, len(runes)/2), 0
+	}
+
+	for i := head; i < len(runes)-tail; i++ {
+		runes[i] = maskRune
+	}
+	return string(runes)
+}
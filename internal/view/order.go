@@ -0,0 +1,39 @@
+package view
+
+import (
+	"order-service/internal/auth"
+	"order-service/internal/models"
+)
+
+// transactionPrefix сколько символов транзакции видно без роли admin
+const transactionPrefix = 8
+
+// Order возвращает заказ в том виде, в каком его может видеть роль:
+//   - admin - целиком;
+//   - support - с маскированными телефоном и email, усеченной транзакцией,
+//     без internal_signature;
+//   - anonymous - дополнительно с маскированными именем и customer_id,
+//     без адреса, индекса и request_id оплаты.
+//
+// Исходный заказ (обычно из кэша) не меняется.
+func Order(order *models.Order, role auth.Role) *models.Order {
+	if role == auth.RoleAdmin {
+		return order
+	}
+
+	masked := order.Clone()
+	masked.InternalSignature = ""
+	masked.Delivery.Phone = MaskPhone(order.Delivery.Phone)
+	masked.Delivery.Email = MaskEmail(order.Delivery.Email)
+	masked.Payment.Transaction = Truncate(order.Payment.Transaction, transactionPrefix)
+	if role == auth.RoleSupport {
+		return masked
+	}
+
+	masked.CustomerID = maskMiddle(order.CustomerID, 1, 0)
+	masked.Delivery.Name = MaskName(order.Delivery.Name)
+	masked.Delivery.Address = Hide(order.Delivery.Address)
+	masked.Delivery.Zip = Hide(order.Delivery.Zip)
+	masked.Payment.RequestID = ""
+	return masked
+}
@@ -0,0 +1,68 @@
+package view_test
+
+import (
+	"testing"
+
+	"order-service/internal/auth"
+	"order-service/internal/models"
+	"order-service/internal/view"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMask(t *testing.T) {
+	assert.Equal(t, "+972*****00", view.MaskPhone("+9720000000"))
+	assert.Equal(t, "t***@gmail.com", view.MaskEmail("test@gmail.com"))
+	assert.Equal(t, "T*** T*****", view.MaskName("Test Testov"))
+	assert.Equal(t, "И*** П*****", view.MaskName("Иван  Петров"))
+	assert.Equal(t, "b563feb7…", view.Truncate("b563feb7b2b84b6test", 8))
+	assert.Equal(t, "short", view.Truncate("short", 8))
+
+	// Короткие значения раскрываются не больше чем наполовину
+	assert.Equal(t, "12***", view.MaskPhone("12345"))
+	assert.Equal(t, "*", view.MaskName("A"))
+	assert.Equal(t, "*****", view.MaskEmail("@mail"))
+}
+
+func TestOrder(t *testing.T) {
+	order := &models.Order{
+		OrderUID: "order1", CustomerID: "test", InternalSignature: "sig",
+		Delivery: models.Delivery{
+			Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Email: "test@gmail.com",
+		},
+		Payment: models.Payment{Transaction: "b563feb7b2b84b6test", RequestID: "req", Amount: 1817},
+		Items:   []models.Item{{Name: "Mascaras"}},
+	}
+
+	t.Run("admin sees everything", func(t *testing.T) {
+		assert.Equal(t, order, view.Order(order, auth.RoleAdmin))
+	})
+
+	t.Run("support", func(t *testing.T) {
+		masked := view.Order(order, auth.RoleSupport)
+		assert.Equal(t, "Test Testov", masked.Delivery.Name)
+		assert.Equal(t, "Ploshad Mira 15", masked.Delivery.Address)
+		assert.Equal(t, "+972*****00", masked.Delivery.Phone)
+		assert.Equal(t, "t***@gmail.com", masked.Delivery.Email)
+		assert.Equal(t, "b563feb7…", masked.Payment.Transaction)
+		assert.Empty(t, masked.InternalSignature)
+	})
+
+	t.Run("anonymous", func(t *testing.T) {
+		masked := view.Order(order, auth.RoleAnonymous)
+		assert.Equal(t, "T*** T*****", masked.Delivery.Name)
+		assert.Equal(t, "***", masked.Delivery.Address)
+		assert.Equal(t, "***", masked.Delivery.Zip)
+		assert.Equal(t, "Kiryat Mozkin", masked.Delivery.City)
+		assert.Equal(t, "t***", masked.CustomerID)
+		assert.Empty(t, masked.Payment.RequestID)
+		assert.Equal(t, 1817, masked.Payment.Amount)
+	})
+
+	t.Run("source order untouched", func(t *testing.T) {
+		view.Order(order, auth.RoleAnonymous)
+		assert.Equal(t, "+9720000000", order.Delivery.Phone)
+		assert.Equal(t, "sig", order.InternalSignature)
+	})
+}